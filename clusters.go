@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// NewClusterParams returns the validated params for releasing to the cluster of the credential: the defaults of the credential merged with the stage params, with the placeholders from files below and the cluster placeholders for the credential on top
+func NewClusterParams(credential GKECredentials, paramsYAML string) (Params, error) {
+
+	var stage Params
+	stageKeys, err := UnmarshalParamsStrict(paramsYAML, &stage)
+	if err != nil {
+		return stage, err
+	}
+
+	if credential.AdditionalProperties.Defaults != nil {
+		log.Info().Msgf("Merging defaults from credential %v...", credential.Name)
+	}
+	params, sources := MergeParams(credential.AdditionalProperties.Defaults, stage, stageKeys)
+
+	// the files the placeholders from files came from, so their values aren't logged
+	placeholderFiles := map[string]string{}
+	if len(params.PlaceholderFiles) > 0 || len(params.FilePlaceholders) > 0 {
+		log.Info().Msgf("Loading placeholders from files for credential %v...", credential.Name)
+		filePlaceholders, files, err := LoadPlaceholderFiles(params.PlaceholderFiles, params.FilePlaceholders)
+		if err != nil {
+			return params, err
+		}
+		placeholderFiles = files
+
+		// placeholders set inline take precedence over the ones from files
+		for k, v := range params.Placeholders {
+			filePlaceholders[k] = v
+			delete(placeholderFiles, k)
+		}
+		params.Placeholders = filePlaceholders
+		sources["placeholders"] = strings.TrimPrefix(sources["placeholders"]+" and "+sourcePlaceholderFiles, " and ")
+	}
+
+	if clusterPlaceholders, ok := params.ClusterPlaceholders[credential.Name]; ok {
+		placeholders := map[string]string{}
+		for k, v := range params.Placeholders {
+			placeholders[k] = v
+		}
+		for k, v := range clusterPlaceholders {
+			placeholders[k] = v
+			delete(placeholderFiles, k)
+		}
+		params.Placeholders = placeholders
+		sources["placeholders"] = strings.TrimPrefix(sources["placeholders"]+" and "+sourceClusterPlaceholders, " and ")
+	}
+
+	setDefaultsWithSources(&params, sources)
+
+	err = params.Validate()
+	if err != nil {
+		return params, fmt.Errorf("Invalid parameters: %w", err)
+	}
+
+	log.Info().Msgf("Effective parameters for credential %v:\n%v", credential.Name, effectiveParams(params, sources, placeholderFiles))
+
+	return params, nil
+}
+
+// clusterResult is the outcome of the release to a single cluster
+type clusterResult struct {
+	deployer *Deployer
+	started  bool
+	err      error
+	duration time.Duration
+}
+
+// ReleaseToClusters runs the deployers one after another, stopping at the first failure, or all at once if parallel is set; it logs a table with the result per cluster
+func ReleaseToClusters(ctx context.Context, deployers []*Deployer, parallel bool) error {
+
+	results := make([]clusterResult, len(deployers))
+	release := func(i int) {
+		start := time.Now()
+		results[i].started = true
+		results[i].err = deployers[i].Deploy(ctx)
+		results[i].duration = time.Since(start)
+	}
+
+	for i, d := range deployers {
+		results[i].deployer = d
+	}
+
+	if parallel {
+		var wg sync.WaitGroup
+		for i := range deployers {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				release(i)
+			}(i)
+		}
+		wg.Wait()
+	} else {
+		for i := range deployers {
+			log.Info().Msgf("Releasing to cluster %v with credential %v...", deployers[i].credential.AdditionalProperties.Cluster, deployers[i].credential.Name)
+			release(i)
+			if results[i].err != nil {
+				break
+			}
+		}
+	}
+
+	log.Info().Msgf("Release results:\n%v", resultsTable(results))
+
+	errs := []error{}
+	for _, r := range results {
+		if r.err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", r.deployer.credential.Name, r.err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func resultsTable(results []clusterResult) string {
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CREDENTIAL\tCLUSTER\tPROJECT\tRESULT\tDURATION")
+	for _, r := range results {
+		result := "succeeded"
+		switch {
+		case !r.started:
+			result = "skipped"
+		case r.err != nil:
+			result = "failed"
+		}
+		properties := r.deployer.credential.AdditionalProperties
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", r.deployer.credential.Name, properties.Cluster, properties.Project, result, r.duration.Round(time.Second))
+	}
+	w.Flush()
+	return sb.String()
+}
@@ -1,19 +1,44 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 // CredentialsParam is used to first retrieve credentials and use any defaults set there
 type CredentialsParam struct {
-	Credentials string `json:"credentials,omitempty"`
+	Credentials         CredentialNames `json:"credentials,omitempty"`
+	CredentialsSelector string          `json:"credentialsSelector,omitempty"`
+	ParallelClusters    bool            `json:"parallelClusters,omitempty"`
+}
+
+// CredentialNames holds one or more credential names and can be set with a single name or a list of names
+type CredentialNames []string
+
+// UnmarshalJSON accepts both a string and a list of strings
+func (n *CredentialNames) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*n = CredentialNames{name}
+		return nil
+	}
+
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return fmt.Errorf("Credentials should be a credential name or a list of credential names: %w", err)
+	}
+	*n = names
+
+	return nil
 }
 
 // SetDefaults fills in empty fields with convention-based defaults
 func (p *CredentialsParam) SetDefaults(releaseName string) {
 	// default credentials to release name prefixed with gke if no override in stage params
-	if p.Credentials == "" && releaseName != "" {
-		p.Credentials = fmt.Sprintf("gke-%v", releaseName)
+	if len(p.Credentials) == 0 && p.CredentialsSelector == "" && releaseName != "" {
+		p.Credentials = CredentialNames{fmt.Sprintf("gke-%v", releaseName)}
 	}
 }
 
@@ -23,9 +48,36 @@ func (p *CredentialsParam) ValidateRequiredProperties() (bool, []error) {
 	errors := []error{}
 
 	// validate control params
-	if p.Credentials == "" {
+	if len(p.Credentials) == 0 && p.CredentialsSelector == "" {
 		errors = append(errors, fmt.Errorf("Credentials property is required; set it via credentials property on this stage"))
 	}
+	if len(p.Credentials) > 0 && p.CredentialsSelector != "" {
+		errors = append(errors, fmt.Errorf("Credentials and credentialsSelector properties can't be used together; set only one of them"))
+	}
+	if p.CredentialsSelector != "" {
+		if _, err := labels.Parse(p.CredentialsSelector); err != nil {
+			errors = append(errors, fmt.Errorf("CredentialsSelector property is not a valid label selector: %w", err))
+		}
+	}
 
 	return len(errors) == 0, errors
 }
+
+// ResolveCredentials returns the credentials with the configured names, or the ones whose labels match the selector
+func (p *CredentialsParam) ResolveCredentials(credentials []GKECredentials) ([]GKECredentials, error) {
+
+	if p.CredentialsSelector != "" {
+		return GetCredentialsBySelector(credentials, p.CredentialsSelector)
+	}
+
+	resolved := []GKECredentials{}
+	for _, name := range p.Credentials {
+		credential := GetCredentialsByName(credentials, name)
+		if credential == nil {
+			return nil, fmt.Errorf("Credential with name %v does not exist.", name)
+		}
+		resolved = append(resolved, *credential)
+	}
+
+	return resolved, nil
+}
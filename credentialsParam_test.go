@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -8,7 +9,7 @@ import (
 
 var (
 	validCredentialsParam = CredentialsParam{
-		Credentials: "gke-production",
+		Credentials: CredentialNames{"gke-production"},
 	}
 )
 
@@ -16,28 +17,26 @@ func TestCredentialsParamSetDefaults(t *testing.T) {
 
 	t.Run("DefaultsCredentialsToReleaseNamePrefixedByGKEIfEmpty", func(t *testing.T) {
 
-		params := CredentialsParam{
-			Credentials: "",
-		}
+		params := CredentialsParam{}
 		releaseName := "production"
 
 		// act
 		params.SetDefaults(releaseName)
 
-		assert.Equal(t, "gke-production", params.Credentials)
+		assert.Equal(t, CredentialNames{"gke-production"}, params.Credentials)
 	})
 
 	t.Run("KeepsCredentialsIfNotEmpty", func(t *testing.T) {
 
 		params := CredentialsParam{
-			Credentials: "staging",
+			Credentials: CredentialNames{"staging"},
 		}
 		releaseName := "production"
 
 		// act
 		params.SetDefaults(releaseName)
 
-		assert.Equal(t, "staging", params.Credentials)
+		assert.Equal(t, CredentialNames{"staging"}, params.Credentials)
 	})
 }
 
@@ -45,7 +44,7 @@ func TestCredentialsParamValidateRequiredProperties(t *testing.T) {
 	t.Run("ReturnsFalseIfCredentialsIsNotSet", func(t *testing.T) {
 
 		params := validCredentialsParam
-		params.Credentials = ""
+		params.Credentials = nil
 
 		// act
 		valid, errors := params.ValidateRequiredProperties()
@@ -57,7 +56,7 @@ func TestCredentialsParamValidateRequiredProperties(t *testing.T) {
 	t.Run("ReturnsTrueIfCredentialsIsSet", func(t *testing.T) {
 
 		params := validCredentialsParam
-		params.Credentials = "gke-production"
+		params.Credentials = CredentialNames{"gke-production"}
 
 		// act
 		valid, errors := params.ValidateRequiredProperties()
@@ -66,4 +65,86 @@ func TestCredentialsParamValidateRequiredProperties(t *testing.T) {
 		assert.True(t, len(errors) == 0)
 	})
 
+	t.Run("ReturnsFalseIfCredentialsAndCredentialsSelectorAreBothSet", func(t *testing.T) {
+
+		params := validCredentialsParam
+		params.CredentialsSelector = "environment=production"
+
+		// act
+		valid, errors := params.ValidateRequiredProperties()
+
+		assert.False(t, valid)
+		assert.True(t, len(errors) > 0)
+	})
+}
+
+func TestCredentialsParamUnmarshalJSON(t *testing.T) {
+
+	t.Run("AcceptsSingleCredentialName", func(t *testing.T) {
+
+		var params CredentialsParam
+
+		// act
+		err := json.Unmarshal([]byte(`{"credentials":"gke-production"}`), &params)
+
+		assert.Nil(t, err)
+		assert.Equal(t, CredentialNames{"gke-production"}, params.Credentials)
+	})
+
+	t.Run("AcceptsListOfCredentialNames", func(t *testing.T) {
+
+		var params CredentialsParam
+
+		// act
+		err := json.Unmarshal([]byte(`{"credentials":["gke-production-europe","gke-production-us"],"parallelClusters":true}`), &params)
+
+		assert.Nil(t, err)
+		assert.Equal(t, CredentialNames{"gke-production-europe", "gke-production-us"}, params.Credentials)
+		assert.True(t, params.ParallelClusters)
+	})
+}
+
+func TestCredentialsParamResolveCredentials(t *testing.T) {
+
+	credentials := []GKECredentials{
+		{Name: "gke-production-europe", AdditionalProperties: GKECredentialAdditionalProperties{Labels: map[string]string{"environment": "production"}}},
+		{Name: "gke-production-us", AdditionalProperties: GKECredentialAdditionalProperties{Labels: map[string]string{"environment": "production"}}},
+		{Name: "gke-staging", AdditionalProperties: GKECredentialAdditionalProperties{Labels: map[string]string{"environment": "staging"}}},
+	}
+
+	t.Run("ReturnsCredentialsWithNamesInOrder", func(t *testing.T) {
+
+		params := CredentialsParam{Credentials: CredentialNames{"gke-staging", "gke-production-us"}}
+
+		// act
+		resolved, err := params.ResolveCredentials(credentials)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(resolved))
+		assert.Equal(t, "gke-staging", resolved[0].Name)
+		assert.Equal(t, "gke-production-us", resolved[1].Name)
+	})
+
+	t.Run("ReturnsErrorIfCredentialWithNameDoesNotExist", func(t *testing.T) {
+
+		params := CredentialsParam{Credentials: CredentialNames{"gke-production-asia"}}
+
+		// act
+		_, err := params.ResolveCredentials(credentials)
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsCredentialsMatchingSelector", func(t *testing.T) {
+
+		params := CredentialsParam{CredentialsSelector: "environment=production"}
+
+		// act
+		resolved, err := params.ResolveCredentials(credentials)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(resolved))
+		assert.Equal(t, "gke-production-europe", resolved[0].Name)
+		assert.Equal(t, "gke-production-us", resolved[1].Name)
+	})
 }
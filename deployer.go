@@ -0,0 +1,904 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Deployer runs the release of the manifests to a gke cluster, using a CommandExecutor for all gcloud calls and an Engine for all cluster operations
+type Deployer struct {
+	executor         CommandExecutor
+	engine           Engine
+	credential       GKECredentials
+	params           Params
+	releaseAction    string
+	builderImageSHA  string
+	builderImageDate string
+
+	sessionDir            string
+	keyFilePath           string
+	renderedDir           string
+	renderedManifests     []string
+	prerequisiteManifests []string
+	crds                  []string
+	environ               []string
+	sleep                 func(time.Duration)
+	accessToken           func(ctx context.Context, credential GKECredentials) (string, error)
+	secrets               SecretResolver
+	redactor              *Redactor
+	revisions             map[string]int64
+	tokenRefreshInterval  time.Duration
+	stopTokenRefresh      context.CancelFunc
+}
+
+// NewDeployer returns a Deployer for the credential and params
+func NewDeployer(executor CommandExecutor, credential GKECredentials, params Params, releaseAction, builderImageSHA, builderImageDate string) *Deployer {
+	redactor := NewRedactor()
+	return &Deployer{
+		executor:             executor.WithRedactor(redactor),
+		credential:           credential,
+		params:               params,
+		releaseAction:        releaseAction,
+		builderImageSHA:      builderImageSHA,
+		builderImageDate:     builderImageDate,
+		environ:              os.Environ(),
+		sleep:                time.Sleep,
+		accessToken:          googleAccessToken,
+		redactor:             redactor,
+		tokenRefreshInterval: accessTokenRefreshInterval,
+	}
+}
+
+// Deploy authenticates to the cluster, renders the manifests and runs the release action
+func (d *Deployer) Deploy(ctx context.Context) (err error) {
+
+	if len(d.params.Manifests) > 0 {
+		log.Info().Msg("Expanding manifests...")
+		d.params.Manifests, err = ExpandManifests(d.params.Manifests, d.params.ExcludeManifests)
+		if err != nil {
+			return err
+		}
+		log.Info().Msgf("Releasing manifests %v", d.params.Manifests)
+	}
+
+	cleanup, err := d.startSession()
+	if err != nil {
+		return err
+	}
+
+	// the session is removed when the release finishes, also when it's canceled since that kills the running command
+	defer cleanup()
+
+	err = d.Authenticate(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = d.initEngine()
+	if err != nil {
+		return err
+	}
+
+	// create 'rendered' directory
+	d.renderedDir, err = ioutil.TempDir("", "rendered-*")
+	if err != nil {
+		return fmt.Errorf("Failed creating a temporary directory for rendered manifests: %w", err)
+	}
+
+	defer os.RemoveAll(d.renderedDir)
+
+	err = d.Render(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = d.OrderManifests()
+	if err != nil {
+		return err
+	}
+
+	if d.releaseAction == "delete" {
+		return d.Delete(ctx)
+	}
+
+	err = d.DiscoverWorkloads()
+	if err != nil {
+		return err
+	}
+
+	return d.Apply(ctx)
+}
+
+// startSession creates a temporary directory for the key file, gcloud config and kubeconfig of this release only, and passes them to every gcloud and kubectl command; the returned func removes it
+func (d *Deployer) startSession() (cleanup func(), err error) {
+	d.sessionDir, err = ioutil.TempDir("", "session-*")
+	if err != nil {
+		return nil, fmt.Errorf("Failed creating a temporary directory for the session: %w", err)
+	}
+
+	d.keyFilePath = filepath.Join(d.sessionDir, "key-file.json")
+	d.executor = d.executor.WithEnv(d.sessionEnv())
+
+	return func() {
+		if d.stopTokenRefresh != nil {
+			d.stopTokenRefresh()
+		}
+
+		err := os.RemoveAll(d.sessionDir)
+		if err != nil {
+			log.Warn().Err(err).Msgf("Failed removing session directory %v", d.sessionDir)
+		}
+	}, nil
+}
+
+// sessionEnv returns the environment variables that make gcloud and kubectl use the config of the session instead of the global config
+func (d *Deployer) sessionEnv() []string {
+	return []string{
+		"CLOUDSDK_CONFIG=" + filepath.Join(d.sessionDir, "gcloud"),
+		"KUBECONFIG=" + d.kubeconfigPath(),
+	}
+}
+
+func (d *Deployer) kubeconfigPath() string {
+	return filepath.Join(d.sessionDir, "kubeconfig")
+}
+
+// Authenticate logs in to google cloud with the flow for the type of the credential, optionally impersonating a service account, and retrieves the credentials for the cluster
+func (d *Deployer) Authenticate(ctx context.Context) (err error) {
+
+	err = d.credential.Validate()
+	if err != nil {
+		return err
+	}
+
+	if d.credential.AdditionalProperties.Endpoint != "" {
+		return d.generateKubeconfig(ctx)
+	}
+
+	switch d.credential.Type {
+	case "", credentialTypeServiceAccountKeyfile:
+		err = d.activateServiceAccount(ctx)
+	case credentialTypeAmbient:
+		log.Info().Msg("Authenticating to google cloud with the ambient credentials of the builder")
+	case credentialTypeWorkloadIdentityFederation:
+		err = d.loginWithCredentialConfiguration(ctx)
+	default:
+		return fmt.Errorf("Credential type %v is not supported; use %v, %v or %v", d.credential.Type, credentialTypeServiceAccountKeyfile, credentialTypeAmbient, credentialTypeWorkloadIdentityFederation)
+	}
+	if err != nil {
+		return err
+	}
+
+	if d.credential.AdditionalProperties.ImpersonateServiceAccount != "" {
+		log.Info().Msgf("Impersonating service account %v", d.credential.AdditionalProperties.ImpersonateServiceAccount)
+		err = d.executor.RunCommandWithArgsExtended(ctx, "gcloud", []string{"config", "set", "auth/impersonate_service_account", d.credential.AdditionalProperties.ImpersonateServiceAccount})
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Info().Msg("Setting gcloud project")
+	err = d.executor.RunCommandWithArgsExtended(ctx, "gcloud", []string{"config", "set", "project", d.credential.AdditionalProperties.Project})
+	if err != nil {
+		return err
+	}
+
+	log.Info().Msgf("Getting gke credentials for cluster %v", d.credential.AdditionalProperties.Cluster)
+	clustersGetCredentialsArsgs := []string{"container", "clusters", "get-credentials", d.credential.AdditionalProperties.Cluster}
+	if d.credential.AdditionalProperties.Zone != "" {
+		clustersGetCredentialsArsgs = append(clustersGetCredentialsArsgs, "--zone", d.credential.AdditionalProperties.Zone)
+	} else if d.credential.AdditionalProperties.Region != "" {
+		clustersGetCredentialsArsgs = append(clustersGetCredentialsArsgs, "--region", d.credential.AdditionalProperties.Region)
+	} else {
+		return fmt.Errorf("Credentials have no zone or region; at least one of them has to be defined")
+	}
+	switch d.credential.AdditionalProperties.Connection {
+	case connectionInternalIP:
+		clustersGetCredentialsArsgs = append(clustersGetCredentialsArsgs, "--internal-ip")
+	case connectionDNSEndpoint:
+		clustersGetCredentialsArsgs = append(clustersGetCredentialsArsgs, "--dns-endpoint")
+	}
+
+	err = d.executor.RunCommandWithArgsExtended(ctx, "gcloud", clustersGetCredentialsArsgs)
+	if err != nil {
+		return err
+	}
+
+	if d.credential.AdditionalProperties.ProxyURL != "" {
+		log.Info().Msgf("Connecting to cluster %v through proxy %v", d.credential.AdditionalProperties.Cluster, d.credential.AdditionalProperties.ProxyURL)
+		return SetKubeconfigProxy(d.kubeconfigPath(), d.kubeContext(), d.credential.AdditionalProperties.ProxyURL)
+	}
+
+	return nil
+}
+
+// generateKubeconfig writes the kubeconfig for the endpoint, ca certificate and proxy of the credential with a token file holding an access token for it, without running gcloud; the token is renewed until the session ends
+func (d *Deployer) generateKubeconfig(ctx context.Context) error {
+
+	log.Info().Msgf("Retrieving access token for gke credential %v...", d.credential.Name)
+	token, err := d.accessToken(ctx, d.credential)
+	if err != nil {
+		return err
+	}
+
+	err = WriteTokenFile(d.tokenPath(), token)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Msgf("Generating kubeconfig for cluster %v at endpoint %v", d.credential.AdditionalProperties.Cluster, d.credential.AdditionalProperties.Endpoint)
+	err = GenerateKubeconfig(d.kubeconfigPath(), d.kubeContext(), d.credential.AdditionalProperties, d.tokenPath())
+	if err != nil {
+		return err
+	}
+
+	refreshCtx, cancel := context.WithCancel(ctx)
+	d.stopTokenRefresh = cancel
+	go d.refreshAccessToken(refreshCtx)
+
+	return nil
+}
+
+func (d *Deployer) tokenPath() string {
+	return filepath.Join(d.sessionDir, "token")
+}
+
+// refreshAccessToken renews the access token in the token file, so jobs and rollouts that take longer than the lifetime of a token don't fail halfway
+func (d *Deployer) refreshAccessToken(ctx context.Context) {
+	ticker := time.NewTicker(d.tokenRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		token, err := d.accessToken(ctx, d.credential)
+		if err == nil {
+			err = WriteTokenFile(d.tokenPath(), token)
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Msgf("Failed renewing access token for gke credential %v, retrying in %v", d.credential.Name, d.tokenRefreshInterval)
+		}
+	}
+}
+
+// activateServiceAccount stores the service account keyfile in the session and activates it
+func (d *Deployer) activateServiceAccount(ctx context.Context) error {
+
+	log.Info().Msg("Retrieving service account email from credentials...")
+	saClientEmail, err := serviceAccountEmail(d.credential)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Msgf("Storing gke credential %v on disk...", d.credential.Name)
+	err = ioutil.WriteFile(d.keyFilePath, []byte(d.credential.AdditionalProperties.ServiceAccountKeyfile), 0600)
+	if err != nil {
+		return fmt.Errorf("Failed writing service account keyfile: %w", err)
+	}
+
+	log.Info().Msg("Authenticating to google cloud")
+	err = d.executor.RunCommandWithArgsExtended(ctx, "gcloud", []string{"auth", "activate-service-account", saClientEmail, "--key-file", d.keyFilePath})
+	if err != nil {
+		return err
+	}
+
+	log.Info().Msgf("Setting gcloud account to %v", saClientEmail)
+	return d.executor.RunCommandWithArgsExtended(ctx, "gcloud", []string{"config", "set", "account", saClientEmail})
+}
+
+// loginWithCredentialConfiguration stores the workload identity federation credential configuration in the session and logs in with it; it holds no secrets, only where to get a token exchanged for google credentials
+func (d *Deployer) loginWithCredentialConfiguration(ctx context.Context) error {
+
+	if d.credential.AdditionalProperties.CredentialConfiguration == "" {
+		return fmt.Errorf("Credential %v of type %v has no credentialConfiguration", d.credential.Name, d.credential.Type)
+	}
+
+	log.Info().Msgf("Storing credential configuration of gke credential %v on disk...", d.credential.Name)
+	credentialConfigurationPath := filepath.Join(d.sessionDir, "credential-configuration.json")
+	err := ioutil.WriteFile(credentialConfigurationPath, []byte(d.credential.AdditionalProperties.CredentialConfiguration), 0600)
+	if err != nil {
+		return fmt.Errorf("Failed writing credential configuration: %w", err)
+	}
+
+	log.Info().Msg("Authenticating to google cloud with workload identity federation")
+	return d.executor.RunCommandWithArgsExtended(ctx, "gcloud", []string{"auth", "login", "--cred-file", credentialConfigurationPath})
+}
+
+// serviceAccountEmail returns the client_email from the service account keyfile of the credential
+func serviceAccountEmail(credential GKECredentials) (string, error) {
+	var keyFileMap map[string]interface{}
+	err := json.Unmarshal([]byte(credential.AdditionalProperties.ServiceAccountKeyfile), &keyFileMap)
+	if err != nil {
+		return "", fmt.Errorf("Failed unmarshalling service account keyfile: %w", err)
+	}
+	saClientEmailIntfc, ok := keyFileMap["client_email"]
+	if !ok {
+		return "", fmt.Errorf("Field client_email missing from service account keyfile")
+	}
+	saClientEmail, ok := saClientEmailIntfc.(string)
+	if !ok {
+		return "", fmt.Errorf("Field client_email not of type string")
+	}
+	return saClientEmail, nil
+}
+
+// initEngine creates the engine selected with the engine parameter, once the credentials for the cluster are available
+func (d *Deployer) initEngine() (err error) {
+	if d.engine != nil {
+		return nil
+	}
+
+	switch d.params.Engine {
+	case "native":
+		log.Info().Msg("Using native engine for cluster operations")
+		d.engine, err = NewNativeEngineFromKubeconfig(d.engineOptions())
+		if err != nil {
+			return fmt.Errorf("Failed creating native engine: %w", err)
+		}
+	case "", "kubectl":
+		d.engine = NewKubectlEngine(d.executor, d.engineOptions())
+	default:
+		return fmt.Errorf("Engine %v is not supported; use kubectl or native", d.params.Engine)
+	}
+
+	return nil
+}
+
+func (d *Deployer) engineOptions() EngineOptions {
+	return EngineOptions{
+		Namespace:      d.params.Namespace,
+		Kubeconfig:     d.kubeconfigPath(),
+		Context:        d.kubeContext(),
+		ServerSide:     d.params.ServerSideApply,
+		ForceConflicts: d.params.ForceConflicts,
+		Out:            d.redactor.Writer(os.Stdout),
+		Env:            d.sessionEnv(),
+	}
+}
+
+// kubeContext returns the name of the kubeconfig context gcloud container clusters get-credentials creates for the cluster
+func (d *Deployer) kubeContext() string {
+	location := d.credential.AdditionalProperties.Zone
+	if location == "" {
+		location = d.credential.AdditionalProperties.Region
+	}
+	return fmt.Sprintf("gke_%v_%v_%v", d.credential.AdditionalProperties.Project, location, d.credential.AdditionalProperties.Cluster)
+}
+
+// Render renders all manifests with the selected renderer and stores the result in the rendered directory, followed by the kustomization and chart if set
+func (d *Deployer) Render(ctx context.Context) error {
+
+	placeholders, err := d.resolveSecrets(ctx)
+	if err != nil {
+		return err
+	}
+
+	d.redactSensitivePlaceholders(placeholders)
+
+	params := d.params
+	params.Placeholders = placeholders
+	renderer, err := NewRenderer(params, d.environ)
+	if err != nil {
+		return err
+	}
+
+	d.renderedManifests = []string{}
+	unresolvedPlaceholdersError := &UnresolvedPlaceholdersError{}
+
+	for _, m := range d.params.Manifests {
+		// check if manifest exists
+		if _, err := os.Stat(m); os.IsNotExist(err) {
+			return fmt.Errorf("Manifest %v does not exist", m)
+		}
+
+		// read file
+		manifestContent, err := ioutil.ReadFile(m)
+		if err != nil {
+			return fmt.Errorf("Can't read manifest %v: %w", m, err)
+		}
+
+		renderedManifestContent, err := renderer.Render(m, manifestContent)
+		var unresolvedErr *UnresolvedPlaceholdersError
+		if errors.As(err, &unresolvedErr) {
+			// collect unresolved placeholders for all manifests before failing
+			unresolvedPlaceholdersError.Placeholders = append(unresolvedPlaceholdersError.Placeholders, unresolvedErr.Placeholders...)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		err = d.storeRendered(m, renderedManifestContent)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(unresolvedPlaceholdersError.Placeholders) > 0 {
+		return unresolvedPlaceholdersError
+	}
+
+	if d.params.Kustomize != "" {
+		err = d.renderKustomization(renderer)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.params.Chart != "" {
+		return d.renderChart(ctx, placeholders)
+	}
+
+	return nil
+}
+
+// resolveSecrets returns the placeholders with the secret manager references replaced by the values of the secrets, which are redacted from then on
+func (d *Deployer) resolveSecrets(ctx context.Context) (map[string]string, error) {
+
+	// sort the names so secrets are resolved in the same order for every release
+	names := make([]string, 0, len(d.params.Placeholders))
+	for name := range d.params.Placeholders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	placeholders := map[string]string{}
+	resolved := map[string]string{}
+	for _, name := range names {
+		reference := d.params.Placeholders[name]
+		if !strings.HasPrefix(reference, secretManagerScheme) {
+			placeholders[name] = reference
+			continue
+		}
+
+		value, ok := resolved[reference]
+		if !ok {
+			if d.secrets == nil {
+				d.secrets = NewSecretManagerResolver(d.credential, d.accessToken)
+			}
+
+			log.Info().Msgf("Resolving placeholder %v from secret manager...", name)
+			var err error
+			value, err = d.secrets.Resolve(ctx, reference)
+			if err != nil {
+				return nil, fmt.Errorf("Failed resolving placeholder %v: %w", name, err)
+			}
+			resolved[reference] = value
+			d.redactor.AddValue(value)
+		}
+		placeholders[name] = value
+	}
+
+	return placeholders, nil
+}
+
+// redactSensitivePlaceholders redacts the values of the placeholders, and the environment variables used as placeholders, that are marked as sensitive
+func (d *Deployer) redactSensitivePlaceholders(placeholders map[string]string) {
+	if len(d.params.SensitivePlaceholders) == 0 {
+		return
+	}
+
+	for name, value := range placeholders {
+		if matchesAny(d.params.SensitivePlaceholders, name) {
+			d.redactor.AddValue(value)
+		}
+	}
+	for _, e := range d.environ {
+		keyValue := strings.SplitN(e, "=", 2)
+		if len(keyValue) == 2 && matchesAny(d.params.EnvironmentPlaceholders, keyValue[0]) && matchesAny(d.params.SensitivePlaceholders, keyValue[0]) {
+			d.redactor.AddValue(keyValue[1])
+		}
+	}
+}
+
+// renderKustomization builds the kustomize overlay and renders placeholders either in the files it reads or in its output
+func (d *Deployer) renderKustomization(renderer Renderer) error {
+
+	log.Info().Msgf("Building kustomization %v with placeholders rendered %v the build...", d.params.Kustomize, d.params.KustomizePlaceholders)
+
+	name := filepath.Join(d.params.Kustomize, "kustomize-build.yaml")
+
+	switch d.params.KustomizePlaceholders {
+	case "before":
+		manifestContent, err := BuildKustomization(d.params.Kustomize, renderer)
+		if err != nil {
+			return err
+		}
+		return d.storeRendered(name, string(manifestContent))
+
+	case "", "after":
+		manifestContent, err := BuildKustomization(d.params.Kustomize, nil)
+		if err != nil {
+			return err
+		}
+		renderedManifestContent, err := renderer.Render(name, manifestContent)
+		if err != nil {
+			return err
+		}
+		return d.storeRendered(name, renderedManifestContent)
+	}
+
+	return fmt.Errorf("KustomizePlaceholders %v is not supported; use before or after", d.params.KustomizePlaceholders)
+}
+
+// renderChart renders the helm chart with its values files and the placeholders as value overrides
+func (d *Deployer) renderChart(ctx context.Context, placeholders map[string]string) error {
+
+	log.Info().Msgf("Rendering chart %v as release %v...", d.params.Chart, d.params.ChartReleaseName)
+
+	manifestContent, err := TemplateChart(ctx, d.executor, d.params.Chart, d.params.ChartReleaseName, d.params.Namespace, d.params.ChartValues, placeholders)
+	if err != nil {
+		return err
+	}
+
+	return d.storeRendered(filepath.Join(strings.TrimSuffix(d.params.Chart, ".tgz"), "helm-template.yaml"), manifestContent)
+}
+
+// storeRendered writes a rendered manifest to the rendered directory and adds it to the manifests to release
+func (d *Deployer) storeRendered(name, renderedManifestContent string) error {
+
+	// create directory in case manifest file is not in root of repo
+	renderedFilepath := d.renderedPath(name)
+	renderedFileDir := filepath.Dir(renderedFilepath)
+	err := os.MkdirAll(renderedFileDir, 0777)
+	if err != nil {
+		return fmt.Errorf("Failed creating directory '%v': %w", renderedFileDir, err)
+	}
+
+	// store rendered manifest
+	err = ioutil.WriteFile(renderedFilepath, []byte(renderedManifestContent), 0666)
+	if err != nil {
+		return fmt.Errorf("Failed writing manifest to '%v': %w", renderedFilepath, err)
+	}
+
+	log.Debug().Msgf("\n%v:\n", name)
+	log.Debug().Msgf("%v\n", d.redactor.Redact(RedactSecrets(renderedManifestContent)))
+
+	d.renderedManifests = append(d.renderedManifests, name)
+
+	return nil
+}
+
+// OrderManifests splits the rendered manifests into one manifest per group of kinds, in the order they have to be applied; namespaces and crds become prerequisites that are applied before the other manifests are dry-run
+func (d *Deployer) OrderManifests() error {
+
+	objects := []*unstructured.Unstructured{}
+	for _, m := range d.renderedManifests {
+		manifestObjects, err := readObjects(d.renderedPath(m))
+		if err != nil {
+			return err
+		}
+		objects = append(objects, manifestObjects...)
+	}
+
+	d.renderedManifests = []string{}
+	d.prerequisiteManifests = []string{}
+	d.crds = []string{}
+
+	for i, group := range OrderObjects(objects) {
+		if len(group) == 0 {
+			continue
+		}
+
+		name := fmt.Sprintf("ordered/%02d-%v.yaml", i+1, kindOrder[i].name)
+		content, err := objectsYAML(group)
+		if err != nil {
+			return err
+		}
+		err = d.storeRendered(name, content)
+		if err != nil {
+			return err
+		}
+
+		if i < prerequisiteGroups {
+			d.prerequisiteManifests = append(d.prerequisiteManifests, name)
+		}
+		for _, obj := range group {
+			if obj.GetKind() == "CustomResourceDefinition" {
+				d.crds = append(d.crds, obj.GetName())
+			}
+		}
+	}
+
+	log.Info().Msgf("Releasing objects in order %v", d.renderedManifests)
+
+	return nil
+}
+
+// DiscoverWorkloads fills the deployments, statefulsets, daemonsets and jobs to await from the rendered manifests, for each kind that isn't set explicitly
+func (d *Deployer) DiscoverWorkloads() error {
+
+	renderedPaths := []string{}
+	for _, m := range d.renderedManifests {
+		renderedPaths = append(renderedPaths, d.renderedPath(m))
+	}
+
+	workloads, err := DiscoverWorkloads(renderedPaths, d.params.Namespace)
+	if err != nil {
+		return fmt.Errorf("Failed discovering workloads in rendered manifests: %w", err)
+	}
+
+	if len(d.params.Deployments) == 0 {
+		d.params.Deployments = workloads.Deployments
+	}
+	if len(d.params.Statefulsets) == 0 {
+		d.params.Statefulsets = workloads.Statefulsets
+	}
+	if len(d.params.Daemonsets) == 0 {
+		d.params.Daemonsets = workloads.Daemonsets
+	}
+	if len(d.params.Jobs) == 0 {
+		d.params.Jobs = workloads.Jobs
+	}
+
+	log.Info().Msgf("Awaiting deployments %v, statefulsets %v, daemonsets %v and jobs %v", d.params.Deployments, d.params.Statefulsets, d.params.Daemonsets, d.params.Jobs)
+
+	return nil
+}
+
+// Delete removes the resources defined in the rendered manifests from the cluster
+func (d *Deployer) Delete(ctx context.Context) error {
+
+	// dry-run manifests
+	log.Info().Msg("\nDRYRUN\n")
+	for i := len(d.renderedManifests) - 1; i >= 0; i-- {
+		err := d.engine.Delete(ctx, d.renderedPath(d.renderedManifests[i]), true)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.params.DryRun {
+		return nil
+	}
+
+	log.Info().Msg("\nDELETE\n")
+
+	// delete resources in reverse order, so objects go before the namespaces and crds they depend on
+	for i := len(d.renderedManifests) - 1; i >= 0; i-- {
+		m := d.renderedManifests[i]
+		// delete resources from manifest
+		log.Info().Msgf("Deleting resources defined in the manifest '%v'...", m)
+		err := d.engine.Delete(ctx, d.renderedPath(m), false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Apply dry-runs, diffs and applies the rendered manifests and waits for the workloads to finish rolling out
+func (d *Deployer) Apply(ctx context.Context) error {
+
+	manifests := d.renderedManifests
+	if len(d.prerequisiteManifests) > 0 && !d.params.DryRun && d.releaseAction != "diff" {
+		err := d.applyPrerequisites(ctx)
+		if err != nil {
+			return err
+		}
+		manifests = d.renderedManifests[len(d.prerequisiteManifests):]
+	}
+
+	// dry-run manifests
+	log.Info().Msg("\nDRYRUN\n")
+	for _, m := range manifests {
+		// always perform a dryrun to ensure we're not ending up in a semi broken state where half of the templates is successfully applied and others not
+		err := d.engine.DryRun(ctx, d.renderedPath(m))
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Info().Msg("\nDIFF\n")
+	for _, m := range manifests {
+		// kubectl diff exits with 1 if there are differences and the native engine prints diff errors itself, so the error is ignored
+		_ = d.engine.Diff(ctx, d.renderedPath(m))
+	}
+
+	conflicts := []string{}
+	for _, m := range manifests {
+		manifestConflicts, err := d.engine.Conflicts(ctx, d.renderedPath(m))
+		if err != nil {
+			return err
+		}
+		conflicts = append(conflicts, manifestConflicts...)
+	}
+	for _, c := range conflicts {
+		if d.params.ForceConflicts {
+			log.Warn().Msgf("Field ownership conflict, fields will be taken over: %v", c)
+		} else {
+			log.Warn().Msgf("Field ownership conflict: %v", c)
+		}
+	}
+
+	prunable := []LiveObject{}
+	if d.params.Prune {
+		var err error
+		prunable, err = d.findPrunable(ctx)
+		if err != nil {
+			return err
+		}
+		for _, obj := range prunable {
+			log.Info().Msgf("%v will be pruned", obj)
+		}
+	}
+
+	if d.params.DryRun || d.releaseAction == "diff" {
+		return nil
+	}
+
+	if len(conflicts) > 0 && !d.params.ForceConflicts {
+		return fmt.Errorf("%v field ownership conflict(s); set forceConflicts to take over the fields from their other managers", len(conflicts))
+	}
+
+	if d.params.AwaitZeroReplicas {
+		err := d.awaitZeroReplicas(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.params.AutoRollback {
+		d.recordRevisions(ctx)
+	}
+
+	log.Info().Msg("\nAPPLY\n")
+
+	// apply manifests
+	for _, m := range manifests {
+		// apply manifest for real
+		log.Info().Msgf("Applying manifest '%v'...", m)
+		err := d.engine.Apply(ctx, d.renderedPath(m))
+		if err != nil {
+			return err
+		}
+
+		// add labels to the resources of the file
+		err = d.engine.Label(ctx, d.renderedPath(m), d.labels())
+		if err != nil {
+			log.Error().Msgf("Error with labeling resources in file %v with error: %v", d.renderedPath(m), err)
+		}
+	}
+
+	err := d.awaitRollouts(ctx)
+	if err != nil {
+		return err
+	}
+
+	if d.params.JobTimeoutSeconds > 0 {
+		err = d.awaitJobs(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(prunable) > 0 {
+		log.Info().Msg("\nPRUNE\n")
+		return d.prune(ctx, prunable)
+	}
+
+	return nil
+}
+
+// applyPrerequisites applies the namespaces and crds and waits for the crds to be established, so the objects depending on them can be dry-run
+func (d *Deployer) applyPrerequisites(ctx context.Context) error {
+
+	log.Info().Msg("\nPREREQUISITES\n")
+	for _, m := range d.prerequisiteManifests {
+		err := d.engine.DryRun(ctx, d.renderedPath(m))
+		if err != nil {
+			return err
+		}
+
+		_ = d.engine.Diff(ctx, d.renderedPath(m))
+
+		log.Info().Msgf("Applying manifest '%v'...", m)
+		err = d.engine.Apply(ctx, d.renderedPath(m))
+		if err != nil {
+			return err
+		}
+
+		err = d.engine.Label(ctx, d.renderedPath(m), d.labels())
+		if err != nil {
+			log.Error().Msgf("Error with labeling resources in file %v with error: %v", d.renderedPath(m), err)
+		}
+	}
+
+	for _, crd := range d.crds {
+		log.Info().Msgf("Waiting for crd '%v' to be established...", crd)
+		err := d.engine.AwaitEstablished(ctx, crd)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Deployer) awaitZeroReplicas(ctx context.Context) error {
+	for _, deploy := range d.params.Deployments {
+		log.Info().Msgf("Awaiting for deployment '%v' to scale to 0 replicas...", deploy)
+		for {
+			replicas, exists, err := d.engine.GetDeploymentReplicas(ctx, deploy)
+			if err != nil {
+				return fmt.Errorf("Failed retrieving replicas for deployment '%v': %w", deploy, err)
+			}
+			if !exists {
+				// this is the first time it gets deployed, so nothing to wait for
+				log.Warn().Msgf("Deployment '%v' does not exist yet, no need to wait", deploy)
+				break
+			}
+
+			if replicas == 0 {
+				break
+			}
+
+			log.Info().Msgf("Deployment '%v' has %v replicas; sleeping for 10 seconds", deploy, replicas)
+			d.sleep(10 * time.Second)
+		}
+
+		log.Info().Msgf("Deployment '%v' has scaled to 0 replicas...", deploy)
+	}
+
+	return nil
+}
+
+func (d *Deployer) awaitJobs(ctx context.Context) error {
+	timeoutChan := time.After(time.Second * time.Duration(d.params.JobTimeoutSeconds))
+	for _, job := range d.params.Jobs {
+		log.Info().Msgf("Waiting for job '%v' to finish...", job)
+	JobWaitLoop:
+		for {
+			select {
+			default:
+				succeeded, err := d.engine.JobSucceeded(ctx, job)
+				if err != nil {
+					log.Warn().Err(err).Msgf("Failed retrieving status of job '%v'", job)
+				}
+				if succeeded {
+					log.Info().Msgf("Job '%v' finished successfully.", job)
+					break JobWaitLoop
+				} else {
+					d.sleep(time.Second * 2)
+				}
+			case <-timeoutChan:
+				desc, logs := d.engine.DescribeJob(ctx, job)
+				return fmt.Errorf("Job '%v' timed-out.\nJob Describe:\n%s\n\n\nLogs:\n%s", job, desc, logs)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (d *Deployer) renderedPath(manifest string) string {
+	return filepath.Join(d.renderedDir, manifest)
+}
+
+func (d *Deployer) labels() []string {
+	labels := []string{
+		fmt.Sprintf("estafette.io/builder-image-sha=%v", d.builderImageSHA),
+		fmt.Sprintf("estafette.io/builder-image-date=%v", d.builderImageDate),
+		managedByLabel,
+	}
+	if application := d.application(); application != "" {
+		labels = append(labels, fmt.Sprintf("%v=%v", applicationLabel, application))
+	}
+	return labels
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const diffContextLines = 3
+
+// maxDiffCells limits the size of the longest common subsequence table, so diffing large objects can't run out of memory;
+// changes larger than that are shown as all lines removed and added
+const maxDiffCells = 1 << 22
+
+type diffEdit struct {
+	op   byte
+	line string
+	from int
+	to   int
+}
+
+// unifiedDiff returns a unified diff of two texts in the format kubectl diff prints, or an empty string if they're equal
+func unifiedDiff(fromName, toName, from, to string) string {
+	edits := diffEdits(splitLines(from), splitLines(to))
+
+	var sb strings.Builder
+	for start := 0; start < len(edits); {
+		// find next change
+		for start < len(edits) && edits[start].op == ' ' {
+			start++
+		}
+		if start == len(edits) {
+			break
+		}
+
+		// extend hunk as long as changes are within twice the context of each other
+		hunkStart := start - diffContextLines
+		if hunkStart < 0 {
+			hunkStart = 0
+		}
+		end := start
+		for k := start; k < len(edits); k++ {
+			if edits[k].op != ' ' {
+				end = k
+			} else if k-end > 2*diffContextLines {
+				break
+			}
+		}
+		hunkEnd := end + diffContextLines + 1
+		if hunkEnd > len(edits) {
+			hunkEnd = len(edits)
+		}
+
+		if sb.Len() == 0 {
+			sb.WriteString(fmt.Sprintf("--- %v\n+++ %v\n", fromName, toName))
+		}
+
+		fromCount, toCount := 0, 0
+		for _, e := range edits[hunkStart:hunkEnd] {
+			if e.op != '+' {
+				fromCount++
+			}
+			if e.op != '-' {
+				toCount++
+			}
+		}
+		sb.WriteString(fmt.Sprintf("@@ -%v,%v +%v,%v @@\n", hunkLineNumber(edits[hunkStart].from, fromCount), fromCount, hunkLineNumber(edits[hunkStart].to, toCount), toCount))
+		for _, e := range edits[hunkStart:hunkEnd] {
+			sb.WriteString(fmt.Sprintf("%c%v\n", e.op, e.line))
+		}
+
+		start = hunkEnd
+	}
+
+	return sb.String()
+}
+
+// diffEdits returns the edits that turn the from lines into the to lines; only the lines between the common prefix and suffix are
+// compared with a longest common subsequence table, which usually keeps it small since applies change only a few fields
+func diffEdits(fromLines, toLines []string) []diffEdit {
+	prefix := 0
+	for prefix < len(fromLines) && prefix < len(toLines) && fromLines[prefix] == toLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(fromLines)-prefix && suffix < len(toLines)-prefix && fromLines[len(fromLines)-1-suffix] == toLines[len(toLines)-1-suffix] {
+		suffix++
+	}
+
+	edits := []diffEdit{}
+	for k := 0; k < prefix; k++ {
+		edits = append(edits, diffEdit{' ', fromLines[k], k, k})
+	}
+
+	fromMiddle := fromLines[prefix : len(fromLines)-suffix]
+	toMiddle := toLines[prefix : len(toLines)-suffix]
+	if (len(fromMiddle)+1)*(len(toMiddle)+1) > maxDiffCells {
+		for k, line := range fromMiddle {
+			edits = append(edits, diffEdit{'-', line, prefix + k, prefix})
+		}
+		for k, line := range toMiddle {
+			edits = append(edits, diffEdit{'+', line, len(fromLines) - suffix, prefix + k})
+		}
+	} else {
+		edits = append(edits, lcsEdits(fromMiddle, toMiddle, prefix)...)
+	}
+
+	for k := suffix; k > 0; k-- {
+		edits = append(edits, diffEdit{' ', fromLines[len(fromLines)-k], len(fromLines) - k, len(toLines) - k})
+	}
+
+	return edits
+}
+
+// lcsEdits returns the edits between the lines using a longest common subsequence table, with line indexes starting at offset
+func lcsEdits(fromLines, toLines []string, offset int) []diffEdit {
+	// longest common subsequence table, filled from the end so edits can be walked from the start
+	lcs := make([][]int, len(fromLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(toLines)+1)
+	}
+	for i := len(fromLines) - 1; i >= 0; i-- {
+		for j := len(toLines) - 1; j >= 0; j-- {
+			if fromLines[i] == toLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	edits := []diffEdit{}
+	i, j := 0, 0
+	for i < len(fromLines) || j < len(toLines) {
+		switch {
+		case i < len(fromLines) && j < len(toLines) && fromLines[i] == toLines[j]:
+			edits = append(edits, diffEdit{' ', fromLines[i], offset + i, offset + j})
+			i++
+			j++
+		case j < len(toLines) && (i == len(fromLines) || lcs[i][j+1] > lcs[i+1][j]):
+			edits = append(edits, diffEdit{'+', toLines[j], offset + i, offset + j})
+			j++
+		default:
+			edits = append(edits, diffEdit{'-', fromLines[i], offset + i, offset + j})
+			i++
+		}
+	}
+
+	return edits
+}
+
+func hunkLineNumber(index, count int) int {
+	if count == 0 {
+		return index
+	}
+	return index + 1
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+
+	t.Run("ReturnsEmptyStringIfTextsAreEqual", func(t *testing.T) {
+
+		// act
+		diff := unifiedDiff("live", "merged", "a\nb\n", "a\nb\n")
+
+		assert.Equal(t, "", diff)
+	})
+
+	t.Run("ReturnsAddedAndRemovedLinesWithContext", func(t *testing.T) {
+
+		from := "a\nb\nc\nd\ne\nf\ng\nh\n"
+		to := "a\nb\nc\nd\nE\nf\ng\nh\n"
+
+		// act
+		diff := unifiedDiff("live", "merged", from, to)
+
+		assert.Equal(t, "--- live\n+++ merged\n@@ -2,7 +2,7 @@\n b\n c\n d\n-e\n+E\n f\n g\n h\n", diff)
+	})
+
+	t.Run("ReturnsAllLinesAsAddedIfFromIsEmpty", func(t *testing.T) {
+
+		// act
+		diff := unifiedDiff("live", "merged", "", "a\nb\n")
+
+		assert.Equal(t, "--- live\n+++ merged\n@@ -0,0 +1,2 @@\n+a\n+b\n", diff)
+	})
+
+	t.Run("ReturnsSeparateHunksForChangesFarApart", func(t *testing.T) {
+
+		from := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+		to := "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n"
+
+		// act
+		diff := unifiedDiff("live", "merged", from, to)
+
+		assert.Equal(t, "--- live\n+++ merged\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+twelve\n", diff)
+	})
+
+	t.Run("ReturnsAllLinesAsRemovedAndAddedIfChangeIsTooLargeToCompare", func(t *testing.T) {
+
+		from := "apiVersion: v1\n"
+		to := "apiVersion: v1\n"
+		for i := 0; i < 3000; i++ {
+			from += fmt.Sprintf("old-%v\n", i)
+			to += fmt.Sprintf("new-%v\n", i)
+		}
+
+		// act
+		diff := unifiedDiff("live", "merged", from, to)
+
+		assert.True(t, strings.HasPrefix(diff, "--- live\n+++ merged\n@@ -1,3001 +1,3001 @@\n apiVersion: v1\n-old-0\n"))
+		assert.Contains(t, diff, "-old-2999\n+new-0\n")
+		assert.True(t, strings.HasSuffix(diff, "+new-2999\n"))
+	})
+}
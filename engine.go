@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Engine performs the cluster operations of a release for rendered manifest files and the workloads they contain
+type Engine interface {
+	DryRun(ctx context.Context, manifestPath string) error
+	Diff(ctx context.Context, manifestPath string) error
+	Conflicts(ctx context.Context, manifestPath string) ([]string, error)
+	Apply(ctx context.Context, manifestPath string) error
+	Label(ctx context.Context, manifestPath string, labels []string) error
+	Delete(ctx context.Context, manifestPath string, dryRun bool) error
+	AwaitEstablished(ctx context.Context, crdName string) error
+
+	RolloutStatus(ctx context.Context, kind, name string) error
+	RolloutRevision(ctx context.Context, kind, name string) (revision int64, err error)
+	RolloutUndo(ctx context.Context, kind, name string) (revision int64, err error)
+	LabelWorkload(ctx context.Context, kind, name string, labels []string) error
+	GetDeploymentReplicas(ctx context.Context, name string) (replicas int, exists bool, err error)
+	JobSucceeded(ctx context.Context, name string) (bool, error)
+	DescribeJob(ctx context.Context, name string) (description, logs string)
+
+	ListObjects(ctx context.Context, labelSelector string) ([]LiveObject, error)
+	DeleteObject(ctx context.Context, obj LiveObject) error
+}
+
+// crdEstablishedTimeout is how long engines wait for an applied crd to be established
+const crdEstablishedTimeout = 60 * time.Second
+
+// LiveObject identifies an object in the namespace of the release
+type LiveObject struct {
+	Group   string
+	Version string
+	Kind    string
+	Name    string
+	// Owned is set if the object has owner references, like the replicasets of a deployment, so its owner manages it
+	Owned bool
+}
+
+// String returns the object the way kubectl -o name does, e.g. deployment.apps/mydeployment
+func (o LiveObject) String() string {
+	if o.Group == "" {
+		return fmt.Sprintf("%v/%v", strings.ToLower(o.Kind), o.Name)
+	}
+	return fmt.Sprintf("%v.%v/%v", strings.ToLower(o.Kind), o.Group, o.Name)
+}
+
+// EngineOptions configure how an engine connects to the cluster and applies manifests
+type EngineOptions struct {
+	// Namespace is the namespace of the release
+	Namespace string
+	// Kubeconfig is the path of the kubeconfig to connect with; the default loading rules are used if empty
+	Kubeconfig string
+	// Context is the kubeconfig context of the cluster; the current context is used if empty
+	Context string
+	// ServerSide makes the kubectl engine use server-side apply; the native engine always applies server-side
+	ServerSide bool
+	// ForceConflicts takes over fields owned by other field managers when applying server-side
+	ForceConflicts bool
+	// Out receives the output of diffs, or of all operations for the native engine; os.Stdout is used if nil
+	Out io.Writer
+	// Env is added to the environment of the exec credential plugin of the kubeconfig, like gke-gcloud-auth-plugin, when the native engine runs it; the kubectl engine runs with the env of its executor
+	Env []string
+}
+
+// ObjectError is returned by the native engine for every single object an operation failed for
+type ObjectError struct {
+	Operation string
+	Kind      string
+	Namespace string
+	Name      string
+	Err       error
+}
+
+func (e *ObjectError) Error() string {
+	if e.Namespace == "" {
+		return fmt.Sprintf("%v of %v %v failed: %v", e.Operation, e.Kind, e.Name, e.Err)
+	}
+	return fmt.Sprintf("%v of %v %v/%v failed: %v", e.Operation, e.Kind, e.Namespace, e.Name, e.Err)
+}
+
+func (e *ObjectError) Unwrap() error {
+	return e.Err
+}
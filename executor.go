@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// CommandExecutor runs the external commands (gcloud, kubectl) the release depends on, so they can be replaced in tests
+type CommandExecutor interface {
+	RunCommandWithArgsExtended(ctx context.Context, command string, args []string) error
+	GetCommandWithArgsOutput(ctx context.Context, command string, args []string) (string, error)
+	// GetCommandWithArgsStdout returns the standard output of the command only, so warnings on standard error don't end up in it; standard error is added to the error if the command fails
+	GetCommandWithArgsStdout(ctx context.Context, command string, args []string) (string, error)
+	// WithEnv returns a CommandExecutor that runs every command with the environment variables in env on top of the environment of the process
+	WithEnv(env []string) CommandExecutor
+	// WithRedactor returns a CommandExecutor that masks the sensitive values of the redactor in the commands it logs
+	WithRedactor(redactor *Redactor) CommandExecutor
+}
+
+// NewCommandExecutor returns a CommandExecutor that runs commands on the host
+func NewCommandExecutor() CommandExecutor {
+	return &hostCommandExecutor{}
+}
+
+type hostCommandExecutor struct {
+	env      []string
+	redactor *Redactor
+}
+
+func (e *hostCommandExecutor) RunCommandWithArgsExtended(ctx context.Context, command string, args []string) error {
+	cmd := e.command(ctx, command, args)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+func (e *hostCommandExecutor) GetCommandWithArgsOutput(ctx context.Context, command string, args []string) (string, error) {
+	output, err := e.command(ctx, command, args).CombinedOutput()
+
+	return string(output), err
+}
+
+func (e *hostCommandExecutor) GetCommandWithArgsStdout(ctx context.Context, command string, args []string) (string, error) {
+	stderr := &bytes.Buffer{}
+	cmd := e.command(ctx, command, args)
+	cmd.Stderr = io.MultiWriter(os.Stderr, stderr)
+
+	output, err := cmd.Output()
+	if err != nil {
+		return string(output), fmt.Errorf("%w: %v", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return string(output), nil
+}
+
+func (e *hostCommandExecutor) WithEnv(env []string) CommandExecutor {
+	return &hostCommandExecutor{env: append(append([]string{}, e.env...), env...), redactor: e.redactor}
+}
+
+func (e *hostCommandExecutor) WithRedactor(redactor *Redactor) CommandExecutor {
+	return &hostCommandExecutor{env: e.env, redactor: redactor}
+}
+
+// command creates the command the same way foundation does, with the environment of the executor added; the command is killed when ctx is canceled
+func (e *hostCommandExecutor) command(ctx context.Context, command string, args []string) *exec.Cmd {
+	commandLine := fmt.Sprintf("> %v %v", command, strings.Join(args, " "))
+	if e.redactor != nil {
+		commandLine = e.redactor.Redact(commandLine)
+	}
+	log.Debug().Msg(commandLine)
+
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Env = append(os.Environ(), e.env...)
+
+	return cmd
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCommandExecutor records all commands and returns scripted outputs and errors
+type fakeCommandExecutor struct {
+	mu       sync.Mutex
+	commands []string
+	outputs  map[string][]string
+	errors   map[string]error
+	blocking map[string]bool
+	envs     map[string][]string
+}
+
+func newFakeCommandExecutor() *fakeCommandExecutor {
+	return &fakeCommandExecutor{
+		outputs:  map[string][]string{},
+		errors:   map[string]error{},
+		blocking: map[string]bool{},
+		envs:     map[string][]string{},
+	}
+}
+
+func (e *fakeCommandExecutor) RunCommandWithArgsExtended(ctx context.Context, command string, args []string) error {
+	_, err := e.GetCommandWithArgsOutput(ctx, command, args)
+	return err
+}
+
+func (e *fakeCommandExecutor) GetCommandWithArgsOutput(ctx context.Context, command string, args []string) (string, error) {
+	return e.run(ctx, nil, command, args)
+}
+
+func (e *fakeCommandExecutor) GetCommandWithArgsStdout(ctx context.Context, command string, args []string) (string, error) {
+	return e.run(ctx, nil, command, args)
+}
+
+func (e *fakeCommandExecutor) WithEnv(env []string) CommandExecutor {
+	return &fakeEnvCommandExecutor{fake: e, env: env}
+}
+
+func (e *fakeCommandExecutor) WithRedactor(redactor *Redactor) CommandExecutor {
+	return e
+}
+
+func (e *fakeCommandExecutor) run(ctx context.Context, env []string, command string, args []string) (string, error) {
+	commandLine := strings.Join(append([]string{command}, args...), " ")
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.commands = append(e.commands, commandLine)
+	e.envs[commandLine] = env
+
+	// blocking commands run until they're canceled, like a rollout that never finishes
+	if e.blocking[commandLine] {
+		e.mu.Unlock()
+		<-ctx.Done()
+		e.mu.Lock()
+		return "", ctx.Err()
+	}
+
+	// return the scripted outputs in order, repeating the last one
+	output := ""
+	if outputs, ok := e.outputs[commandLine]; ok && len(outputs) > 0 {
+		output = outputs[0]
+		if len(outputs) > 1 {
+			e.outputs[commandLine] = outputs[1:]
+		}
+	}
+
+	return output, e.errors[commandLine]
+}
+
+// recordedCommands returns the recorded commands with the rendered directory replaced by a fixed value
+func (e *fakeCommandExecutor) recordedCommands(renderedDir string) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	commands := []string{}
+	for _, c := range e.commands {
+		if renderedDir != "" {
+			c = strings.ReplaceAll(c, renderedDir, "/rendered")
+		}
+		commands = append(commands, c)
+	}
+
+	return commands
+}
+
+// fakeEnvCommandExecutor records its commands in the fake it was created from, together with the environment they're run with
+type fakeEnvCommandExecutor struct {
+	fake *fakeCommandExecutor
+	env  []string
+}
+
+func (e *fakeEnvCommandExecutor) RunCommandWithArgsExtended(ctx context.Context, command string, args []string) error {
+	_, err := e.fake.run(ctx, e.env, command, args)
+	return err
+}
+
+func (e *fakeEnvCommandExecutor) GetCommandWithArgsOutput(ctx context.Context, command string, args []string) (string, error) {
+	return e.fake.run(ctx, e.env, command, args)
+}
+
+func (e *fakeEnvCommandExecutor) GetCommandWithArgsStdout(ctx context.Context, command string, args []string) (string, error) {
+	return e.fake.run(ctx, e.env, command, args)
+}
+
+func (e *fakeEnvCommandExecutor) WithEnv(env []string) CommandExecutor {
+	return &fakeEnvCommandExecutor{fake: e.fake, env: append(append([]string{}, e.env...), env...)}
+}
+
+func (e *fakeEnvCommandExecutor) WithRedactor(redactor *Redactor) CommandExecutor {
+	return e
+}
+
+func TestHostCommandExecutorGetCommandWithArgsStdout(t *testing.T) {
+
+	t.Run("ReturnsStandardOutputWithoutStandardError", func(t *testing.T) {
+
+		executor := NewCommandExecutor()
+
+		// act
+		output, err := executor.GetCommandWithArgsStdout(context.Background(), "sh", []string{"-c", "echo 'kind: ConfigMap'; echo 'WARNING: kubeconfig is group-readable' >&2"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "kind: ConfigMap\n", output)
+	})
+
+	t.Run("ReturnsErrorWithStandardErrorIfCommandFails", func(t *testing.T) {
+
+		executor := NewCommandExecutor()
+
+		// act
+		_, err := executor.GetCommandWithArgsStdout(context.Background(), "sh", []string{"-c", "echo 'kind: ConfigMap'; echo 'Error: chart not found' >&2; exit 1"})
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "exit status 1: Error: chart not found", err.Error())
+	})
+}
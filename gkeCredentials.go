@@ -1,6 +1,33 @@
 package main
 
-// GKECredentials represents the credentials of type kubernetes-engine as defined in the server config and passed to this trusted image
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// credentialTypeServiceAccountKeyfile authenticates with the json key in serviceAccountKeyfile; it's used if the type is empty as well
+	credentialTypeServiceAccountKeyfile = "kubernetes-engine"
+	// credentialTypeAmbient authenticates with the identity of the builder, like the service account of the node or its workload identity
+	credentialTypeAmbient = "kubernetes-engine-ambient"
+	// credentialTypeWorkloadIdentityFederation authenticates with the workload identity federation credential configuration in credentialConfiguration
+	credentialTypeWorkloadIdentityFederation = "kubernetes-engine-workload-identity-federation"
+)
+
+const (
+	// connectionPublic connects to the public ip of the control plane; it's used if the connection is empty as well
+	connectionPublic = "public"
+	// connectionInternalIP connects to the private ip of the control plane of a private cluster
+	connectionInternalIP = "internal-ip"
+	// connectionDNSEndpoint connects to the dns-based endpoint of the control plane
+	connectionDNSEndpoint = "dns-endpoint"
+)
+
+// GKECredentials represents the credentials of type kubernetes-engine, kubernetes-engine-ambient or kubernetes-engine-workload-identity-federation as defined in the server config and passed to this trusted image
 type GKECredentials struct {
 	Name                 string                            `json:"name,omitempty"`
 	Type                 string                            `json:"type,omitempty"`
@@ -15,6 +42,148 @@ type GKECredentialAdditionalProperties struct {
 	Zone                  string  `json:"zone,omitempty"`
 	ServiceAccountKeyfile string  `json:"serviceAccountKeyfile,omitempty"`
 	Defaults              *Params `json:"defaults,omitempty"`
+
+	CredentialConfiguration   string `json:"credentialConfiguration,omitempty"`
+	ImpersonateServiceAccount string `json:"impersonateServiceAccount,omitempty"`
+
+	Endpoint      string `json:"endpoint,omitempty"`
+	CACertificate string `json:"caCertificate,omitempty"`
+
+	Connection string `json:"connection,omitempty"`
+	ProxyURL   string `json:"proxyURL,omitempty"`
+
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Validate checks the credential has everything needed to authenticate to its cluster, and returns all problems at once
+func (c *GKECredentials) Validate() error {
+
+	errs := []error{}
+	p := c.AdditionalProperties
+
+	if p.Project == "" {
+		errs = append(errs, fmt.Errorf("Project is required"))
+	}
+	if p.Cluster == "" {
+		errs = append(errs, fmt.Errorf("Cluster is required"))
+	}
+	if p.Zone == "" && p.Region == "" {
+		errs = append(errs, fmt.Errorf("Zone or region is required"))
+	}
+
+	switch c.Type {
+	case "", credentialTypeServiceAccountKeyfile:
+		errs = append(errs, validateServiceAccountKeyfile(p.ServiceAccountKeyfile)...)
+	case credentialTypeAmbient:
+	case credentialTypeWorkloadIdentityFederation:
+		errs = append(errs, validateCredentialConfiguration(p.CredentialConfiguration)...)
+	default:
+		errs = append(errs, fmt.Errorf("Type %v is not supported; use %v, %v or %v", c.Type, credentialTypeServiceAccountKeyfile, credentialTypeAmbient, credentialTypeWorkloadIdentityFederation))
+	}
+
+	err := p.validateConnection()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if p.Defaults != nil {
+		for _, err := range p.Defaults.validateValues() {
+			errs = append(errs, fmt.Errorf("Defaults: %w", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("Credential %v is invalid: %w", c.Name, errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// ValidateCredentials validates all credentials and returns the problems of all of them at once
+func ValidateCredentials(credentials []GKECredentials) error {
+	errs := []error{}
+	for _, c := range credentials {
+		err := c.Validate()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func validateServiceAccountKeyfile(keyfile string) []error {
+	if keyfile == "" {
+		return []error{fmt.Errorf("ServiceAccountKeyfile is required")}
+	}
+
+	var key struct {
+		Type        string `json:"type"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+	}
+	err := json.Unmarshal([]byte(keyfile), &key)
+	if err != nil {
+		return []error{fmt.Errorf("ServiceAccountKeyfile is not valid json: %w", err)}
+	}
+
+	errs := []error{}
+	if key.Type != "service_account" {
+		errs = append(errs, fmt.Errorf("ServiceAccountKeyfile has type %q instead of service_account", key.Type))
+	}
+	if key.ClientEmail == "" {
+		errs = append(errs, fmt.Errorf("ServiceAccountKeyfile has no client_email"))
+	}
+	if key.PrivateKey == "" {
+		errs = append(errs, fmt.Errorf("ServiceAccountKeyfile has no private_key"))
+	}
+
+	return errs
+}
+
+func validateCredentialConfiguration(credentialConfiguration string) []error {
+	if credentialConfiguration == "" {
+		return []error{fmt.Errorf("CredentialConfiguration is required")}
+	}
+
+	var configuration struct {
+		Type string `json:"type"`
+	}
+	err := json.Unmarshal([]byte(credentialConfiguration), &configuration)
+	if err != nil {
+		return []error{fmt.Errorf("CredentialConfiguration is not valid json: %w", err)}
+	}
+	if configuration.Type != "external_account" {
+		return []error{fmt.Errorf("CredentialConfiguration has type %q instead of external_account", configuration.Type)}
+	}
+
+	return nil
+}
+
+// validateConnection checks the connection, the proxy url and whether the certificate authority needed for a generated kubeconfig is set
+func (p GKECredentialAdditionalProperties) validateConnection() error {
+
+	switch p.Connection {
+	case "", connectionPublic, connectionInternalIP, connectionDNSEndpoint:
+	default:
+		return fmt.Errorf("Connection %v is not supported; use %v, %v or %v", p.Connection, connectionPublic, connectionInternalIP, connectionDNSEndpoint)
+	}
+
+	if p.ProxyURL != "" {
+		u, err := url.Parse(p.ProxyURL)
+		if err != nil {
+			return fmt.Errorf("Proxy url %v is invalid: %w", p.ProxyURL, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5" {
+			return fmt.Errorf("Proxy url %v has no http, https or socks5 scheme", p.ProxyURL)
+		}
+	}
+
+	// the dns endpoint has a publicly trusted certificate
+	if p.Endpoint != "" && p.CACertificate == "" && p.Connection != connectionDNSEndpoint {
+		return fmt.Errorf("Endpoint %v needs a caCertificate unless the connection is %v", p.Endpoint, connectionDNSEndpoint)
+	}
+
+	return nil
 }
 
 // GetCredentialsByName returns a credential if the name exists
@@ -28,3 +197,25 @@ func GetCredentialsByName(c []GKECredentials, credentialName string) *GKECredent
 
 	return nil
 }
+
+// GetCredentialsBySelector returns all credentials with labels matching the label selector, or an error if there are none
+func GetCredentialsBySelector(c []GKECredentials, selector string) ([]GKECredentials, error) {
+
+	s, err := labels.Parse(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []GKECredentials{}
+	for _, cred := range c {
+		if s.Matches(labels.Set(cred.AdditionalProperties.Labels)) {
+			matches = append(matches, cred)
+		}
+	}
+
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("No credentials match selector %v", selector)
+	}
+
+	return matches, nil
+}
@@ -37,3 +37,124 @@ func TestGetCredentialsByName(t *testing.T) {
 		assert.Nil(t, credential)
 	})
 }
+
+func TestGKECredentialAdditionalPropertiesValidateConnection(t *testing.T) {
+
+	t.Run("ReturnsNilForDNSEndpointWithoutCACertificate", func(t *testing.T) {
+
+		properties := GKECredentialAdditionalProperties{Connection: "dns-endpoint", Endpoint: "gke-0123456789.europe-west1.gke.goog", ProxyURL: "https://proxy.example.com"}
+
+		// act
+		err := properties.validateConnection()
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("ReturnsErrorIfConnectionIsUnknown", func(t *testing.T) {
+
+		properties := GKECredentialAdditionalProperties{Connection: "private"}
+
+		// act
+		err := properties.validateConnection()
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsErrorIfProxyURLHasNoSupportedScheme", func(t *testing.T) {
+
+		properties := GKECredentialAdditionalProperties{ProxyURL: "proxy.example.com:3128"}
+
+		// act
+		err := properties.validateConnection()
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsErrorIfEndpointHasNoCACertificate", func(t *testing.T) {
+
+		properties := GKECredentialAdditionalProperties{Connection: "internal-ip", Endpoint: "10.0.0.2"}
+
+		// act
+		err := properties.validateConnection()
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestGKECredentialsValidate(t *testing.T) {
+
+	t.Run("ReturnsNilIfCredentialIsValid", func(t *testing.T) {
+
+		credential := validCredential
+
+		// act
+		err := credential.Validate()
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("ReturnsAllProblemsAtOnce", func(t *testing.T) {
+
+		credential := GKECredentials{
+			Name: "gke-production",
+			Type: "kubernetes-engine",
+			AdditionalProperties: GKECredentialAdditionalProperties{
+				ServiceAccountKeyfile: `{"type":"authorized_user"}`,
+				Defaults:              &Params{Engine: "helm", RolloutTimeoutSeconds: -1},
+			},
+		}
+
+		// act
+		err := credential.Validate()
+
+		assert.NotNil(t, err)
+		assert.Equal(t, `Credential gke-production is invalid: Project is required
+Cluster is required
+Zone or region is required
+ServiceAccountKeyfile has type "authorized_user" instead of service_account
+ServiceAccountKeyfile has no client_email
+ServiceAccountKeyfile has no private_key
+Defaults: Engine helm is not supported; use kubectl or native
+Defaults: RolloutTimeoutSeconds -1 can't be negative`, err.Error())
+	})
+
+	t.Run("ReturnsErrorIfCredentialConfigurationIsNotExternalAccount", func(t *testing.T) {
+
+		credential := validCredential
+		credential.Type = "kubernetes-engine-workload-identity-federation"
+		credential.AdditionalProperties.CredentialConfiguration = validKeyfile
+
+		// act
+		err := credential.Validate()
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsNilForAmbientCredentialWithoutKeyfile", func(t *testing.T) {
+
+		credential := validCredential
+		credential.Type = "kubernetes-engine-ambient"
+		credential.AdditionalProperties.ServiceAccountKeyfile = ""
+
+		// act
+		err := credential.Validate()
+
+		assert.Nil(t, err)
+	})
+}
+
+func TestValidateCredentials(t *testing.T) {
+
+	t.Run("ReturnsProblemsOfAllCredentials", func(t *testing.T) {
+
+		credentials := []GKECredentials{validCredential, {Name: "gke-staging", Type: "kubernetes-engine-ambient"}, {Name: "gke-development", Type: "kubernetes-engine-ambient"}}
+
+		// act
+		err := ValidateCredentials(credentials)
+
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "Credential gke-staging is invalid")
+		assert.Contains(t, err.Error(), "Credential gke-development is invalid")
+		assert.NotContains(t, err.Error(), "Credential gke-production")
+	})
+}
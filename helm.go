@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TemplateChart renders a local chart directory or packaged .tgz chart with helm template, using the placeholders as string value overrides on top of the values files
+func TemplateChart(ctx context.Context, executor CommandExecutor, chart, releaseName, namespace string, valuesFiles []string, placeholders map[string]string) (string, error) {
+
+	args := []string{"template", releaseName, chart, "--include-crds"}
+	if namespace != "" {
+		args = append(args, "--namespace", namespace)
+	}
+	for _, v := range valuesFiles {
+		args = append(args, "--values", v)
+	}
+
+	// sort the placeholders so the command is the same for every release
+	keys := make([]string, 0, len(placeholders))
+	for k := range placeholders {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "--set-string", fmt.Sprintf("%v=%v", k, escapeHelmValue(placeholders[k])))
+	}
+
+	// helm writes warnings to stderr, those shouldn't end up in the rendered manifest
+	output, err := executor.GetCommandWithArgsStdout(ctx, "helm", args)
+	if err != nil {
+		return "", fmt.Errorf("Failed rendering chart %v: %w", chart, err)
+	}
+
+	return output, nil
+}
+
+// escapeHelmValue escapes the characters helm interprets in --set values, so placeholder values are passed as is
+func escapeHelmValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `,`, `\,`).Replace(value)
+}
+
+// chartName returns the name of a chart directory or packaged chart, to be used as default release name
+func chartName(chart string) string {
+	name := strings.TrimSuffix(strings.TrimSuffix(chart, "/"), ".tgz")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateChart(t *testing.T) {
+
+	t.Run("PassesPlaceholdersSortedAndEscapedAsStringValues", func(t *testing.T) {
+
+		executor := newFakeCommandExecutor()
+
+		// act
+		_, err := TemplateChart(context.Background(), executor, "charts/redis", "redis", "", nil, map[string]string{"b": "x,y", "a": "1"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{`helm template redis charts/redis --include-crds --set-string a=1 --set-string b=x\,y`}, executor.recordedCommands(""))
+	})
+
+	t.Run("ReturnsErrorWithStandardErrorIfHelmFails", func(t *testing.T) {
+
+		executor := newFakeCommandExecutor()
+		executor.errors["helm template redis charts/redis --include-crds"] = errors.New("exit status 1: Error: Chart.yaml file is missing")
+
+		// act
+		_, err := TemplateChart(context.Background(), executor, "charts/redis", "redis", "", nil, nil)
+
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "Chart.yaml file is missing")
+	})
+}
+
+func TestChartName(t *testing.T) {
+
+	t.Run("ReturnsDirectoryNameForChartDirectory", func(t *testing.T) {
+
+		// act
+		name := chartName("charts/redis/")
+
+		assert.Equal(t, "redis", name)
+	})
+
+	t.Run("ReturnsFileNameWithoutExtensionForPackagedChart", func(t *testing.T) {
+
+		// act
+		name := chartName("charts/redis-17.3.0.tgz")
+
+		assert.Equal(t, "redis-17.3.0", name)
+	})
+}
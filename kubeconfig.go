@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// cloudPlatformScope is the oauth2 scope gke accepts tokens for
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// accessTokenRefreshInterval is how often the access token in the token file is renewed; google access tokens expire after an hour
+const accessTokenRefreshInterval = 30 * time.Minute
+
+// GenerateKubeconfig writes a kubeconfig to path for the cluster at the endpoint of the credential properties, trusting their base64 encoded pem caCertificate if set and connecting through their proxy url if set, and authenticating with the bearer token in tokenFile, which kubectl and client-go read again when it changes, with contextName as current context
+func GenerateKubeconfig(path, contextName string, properties GKECredentialAdditionalProperties, tokenFile string) error {
+
+	cluster := &clientcmdapi.Cluster{Server: properties.Endpoint, ProxyURL: properties.ProxyURL}
+	if !strings.HasPrefix(cluster.Server, "https://") {
+		cluster.Server = "https://" + cluster.Server
+	}
+
+	if properties.CACertificate != "" {
+		ca, err := base64.StdEncoding.DecodeString(properties.CACertificate)
+		if err != nil {
+			return fmt.Errorf("Failed decoding ca certificate: %w", err)
+		}
+		cluster.CertificateAuthorityData = ca
+	}
+
+	config := clientcmdapi.NewConfig()
+	config.Clusters[contextName] = cluster
+	config.AuthInfos[contextName] = &clientcmdapi.AuthInfo{TokenFile: tokenFile}
+	config.Contexts[contextName] = &clientcmdapi.Context{Cluster: contextName, AuthInfo: contextName}
+	config.CurrentContext = contextName
+
+	return clientcmd.WriteToFile(*config, path)
+}
+
+// WriteTokenFile replaces the token in the file at path at once, so it's never read half written
+func WriteTokenFile(path, token string) error {
+
+	tmpPath := path + ".tmp"
+	err := os.WriteFile(tmpPath, []byte(token), 0600)
+	if err != nil {
+		return fmt.Errorf("Failed writing token file: %w", err)
+	}
+
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return fmt.Errorf("Failed replacing token file: %w", err)
+	}
+
+	return nil
+}
+
+// SetKubeconfigProxy makes the cluster of the context in the kubeconfig at path connect through the proxy url
+func SetKubeconfigProxy(path, contextName, proxyURL string) error {
+
+	config, err := clientcmd.LoadFromFile(path)
+	if err != nil {
+		return fmt.Errorf("Failed loading kubeconfig: %w", err)
+	}
+
+	kubeContext, ok := config.Contexts[contextName]
+	if !ok {
+		return fmt.Errorf("Kubeconfig has no context %v", contextName)
+	}
+	cluster, ok := config.Clusters[kubeContext.Cluster]
+	if !ok {
+		return fmt.Errorf("Kubeconfig has no cluster %v for context %v", kubeContext.Cluster, contextName)
+	}
+	cluster.ProxyURL = proxyURL
+
+	return clientcmd.WriteToFile(*config, path)
+}
+
+// googleAccessToken returns an oauth2 access token for the credential, obtained with the flow for the type of the credential and optionally impersonating a service account
+func googleAccessToken(ctx context.Context, credential GKECredentials) (string, error) {
+
+	var credentials *google.Credentials
+	var err error
+	switch credential.Type {
+	case "", credentialTypeServiceAccountKeyfile:
+		credentials, err = google.CredentialsFromJSON(ctx, []byte(credential.AdditionalProperties.ServiceAccountKeyfile), cloudPlatformScope)
+	case credentialTypeAmbient:
+		credentials, err = google.FindDefaultCredentials(ctx, cloudPlatformScope)
+	case credentialTypeWorkloadIdentityFederation:
+		credentials, err = google.CredentialsFromJSON(ctx, []byte(credential.AdditionalProperties.CredentialConfiguration), cloudPlatformScope)
+	default:
+		return "", fmt.Errorf("Credential type %v is not supported; use %v, %v or %v", credential.Type, credentialTypeServiceAccountKeyfile, credentialTypeAmbient, credentialTypeWorkloadIdentityFederation)
+	}
+	if err != nil {
+		return "", fmt.Errorf("Failed retrieving google credentials for credential %v: %w", credential.Name, err)
+	}
+
+	if credential.AdditionalProperties.ImpersonateServiceAccount != "" {
+		return impersonatedAccessToken(ctx, credentials.TokenSource, credential.AdditionalProperties.ImpersonateServiceAccount)
+	}
+
+	token, err := credentials.TokenSource.Token()
+	if err != nil {
+		return "", fmt.Errorf("Failed retrieving access token for credential %v: %w", credential.Name, err)
+	}
+
+	return token.AccessToken, nil
+}
+
+// impersonatedAccessToken exchanges the token of tokenSource for an access token of the service account with the iam credentials api
+func impersonatedAccessToken(ctx context.Context, tokenSource oauth2.TokenSource, serviceAccount string) (string, error) {
+
+	body, err := json.Marshal(map[string]interface{}{"scope": []string{cloudPlatformScope}})
+	if err != nil {
+		return "", err
+	}
+
+	generateAccessTokenURL := fmt.Sprintf("https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/%v:generateAccessToken", url.PathEscape(serviceAccount))
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, generateAccessTokenURL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := oauth2.NewClient(ctx, tokenSource).Do(request)
+	if err != nil {
+		return "", fmt.Errorf("Failed impersonating service account %v: %w", serviceAccount, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Failed impersonating service account %v: status %v", serviceAccount, response.Status)
+	}
+
+	var result struct {
+		AccessToken string `json:"accessToken"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		return "", fmt.Errorf("Failed decoding access token of service account %v: %w", serviceAccount, err)
+	}
+
+	return result.AccessToken, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func TestGenerateKubeconfig(t *testing.T) {
+
+	t.Run("WritesKubeconfigWithCertificateAuthorityAndTokenFile", func(t *testing.T) {
+
+		path := filepath.Join(t.TempDir(), "kubeconfig")
+		properties := GKECredentialAdditionalProperties{Endpoint: "https://production.example.com", CACertificate: base64.StdEncoding.EncodeToString([]byte("ca"))}
+
+		// act
+		err := GenerateKubeconfig(path, "gke_my-project_europe-west1_production-cluster", properties, "/session/token")
+
+		assert.Nil(t, err)
+		config, err := clientcmd.LoadFromFile(path)
+		assert.Nil(t, err)
+		assert.Equal(t, "gke_my-project_europe-west1_production-cluster", config.CurrentContext)
+		assert.Equal(t, "https://production.example.com", config.Clusters["gke_my-project_europe-west1_production-cluster"].Server)
+		assert.Equal(t, []byte("ca"), config.Clusters["gke_my-project_europe-west1_production-cluster"].CertificateAuthorityData)
+		assert.Equal(t, "/session/token", config.AuthInfos["gke_my-project_europe-west1_production-cluster"].TokenFile)
+	})
+
+	t.Run("ReturnsErrorIfCertificateAuthorityIsNotBase64", func(t *testing.T) {
+
+		path := filepath.Join(t.TempDir(), "kubeconfig")
+
+		// act
+		err := GenerateKubeconfig(path, "production", GKECredentialAdditionalProperties{Endpoint: "34.78.1.2", CACertificate: "not base64!"}, "/session/token")
+
+		assert.NotNil(t, err)
+		assert.NoFileExists(t, path)
+	})
+
+	t.Run("WritesKubeconfigWithProxyAndWithoutCertificateAuthorityForDNSEndpoint", func(t *testing.T) {
+
+		path := filepath.Join(t.TempDir(), "kubeconfig")
+		properties := GKECredentialAdditionalProperties{Endpoint: "gke-0123456789.europe-west1.gke.goog", Connection: "dns-endpoint", ProxyURL: "http://proxy.example.com:3128"}
+
+		// act
+		err := GenerateKubeconfig(path, "production", properties, "/session/token")
+
+		assert.Nil(t, err)
+		config, err := clientcmd.LoadFromFile(path)
+		assert.Nil(t, err)
+		assert.Equal(t, "https://gke-0123456789.europe-west1.gke.goog", config.Clusters["production"].Server)
+		assert.Equal(t, "http://proxy.example.com:3128", config.Clusters["production"].ProxyURL)
+		assert.Nil(t, config.Clusters["production"].CertificateAuthorityData)
+	})
+}
+
+func TestWriteTokenFile(t *testing.T) {
+
+	t.Run("ReplacesTokenInFile", func(t *testing.T) {
+
+		path := filepath.Join(t.TempDir(), "token")
+		assert.Nil(t, WriteTokenFile(path, "access-token-1"))
+
+		// act
+		err := WriteTokenFile(path, "access-token-2")
+
+		assert.Nil(t, err)
+		token, err := os.ReadFile(path)
+		assert.Nil(t, err)
+		assert.Equal(t, "access-token-2", string(token))
+	})
+}
+
+func TestSetKubeconfigProxy(t *testing.T) {
+
+	t.Run("SetsProxyOfClusterOfContext", func(t *testing.T) {
+
+		path := filepath.Join(t.TempDir(), "kubeconfig")
+		err := GenerateKubeconfig(path, "production", GKECredentialAdditionalProperties{Endpoint: "10.0.0.2", CACertificate: base64.StdEncoding.EncodeToString([]byte("ca"))}, "/session/token")
+		assert.Nil(t, err)
+
+		// act
+		err = SetKubeconfigProxy(path, "production", "socks5://localhost:1080")
+
+		assert.Nil(t, err)
+		config, err := clientcmd.LoadFromFile(path)
+		assert.Nil(t, err)
+		assert.Equal(t, "socks5://localhost:1080", config.Clusters["production"].ProxyURL)
+	})
+
+	t.Run("ReturnsErrorIfContextDoesNotExist", func(t *testing.T) {
+
+		path := filepath.Join(t.TempDir(), "kubeconfig")
+		err := GenerateKubeconfig(path, "production", GKECredentialAdditionalProperties{Endpoint: "10.0.0.2"}, "/session/token")
+		assert.Nil(t, err)
+
+		// act
+		err = SetKubeconfigProxy(path, "staging", "socks5://localhost:1080")
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestGoogleAccessToken(t *testing.T) {
+
+	t.Run("ReturnsErrorIfKeyfileIsInvalid", func(t *testing.T) {
+
+		credential := GKECredentials{Name: "gke-production", Type: "kubernetes-engine", AdditionalProperties: GKECredentialAdditionalProperties{ServiceAccountKeyfile: "{"}}
+
+		// act
+		_, err := googleAccessToken(context.Background(), credential)
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsErrorIfCredentialTypeIsUnknown", func(t *testing.T) {
+
+		credential := GKECredentials{Name: "gke-production", Type: "kubernetes-engine-oidc"}
+
+		// act
+		_, err := googleAccessToken(context.Background(), credential)
+
+		assert.NotNil(t, err)
+	})
+}
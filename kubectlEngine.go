@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NewKubectlEngine returns an Engine that shells out to kubectl for every operation
+func NewKubectlEngine(executor CommandExecutor, options EngineOptions) Engine {
+	return &kubectlEngine{
+		executor: executor,
+		options:  options,
+	}
+}
+
+type kubectlEngine struct {
+	executor CommandExecutor
+	options  EngineOptions
+}
+
+// run runs kubectl against the context of the engine
+func (e *kubectlEngine) run(ctx context.Context, args []string) error {
+	return e.executor.RunCommandWithArgsExtended(ctx, "kubectl", e.withContext(args))
+}
+
+// output runs kubectl against the context of the engine and returns its output
+func (e *kubectlEngine) output(ctx context.Context, args []string) (string, error) {
+	return e.executor.GetCommandWithArgsOutput(ctx, "kubectl", e.withContext(args))
+}
+
+func (e *kubectlEngine) withContext(args []string) []string {
+	if e.options.Context == "" {
+		return args
+	}
+	return append(args, "--context="+e.options.Context)
+}
+
+func (e *kubectlEngine) DryRun(ctx context.Context, manifestPath string) error {
+	// conflicts are reported by Conflicts, so the dry-run validates the manifests as if they're forced
+	return e.run(ctx, append([]string{"apply", "-f", manifestPath, "-n", e.options.Namespace, "--dry-run=server"}, e.serverSideArgs(true)...))
+}
+
+// Diff prints the diff through the output of the engine instead of letting kubectl write to stdout, so the values of secrets can be masked and other secrets redacted
+func (e *kubectlEngine) Diff(ctx context.Context, manifestPath string) error {
+	output, err := e.output(ctx, append([]string{"diff", "-f", manifestPath, "-n", e.options.Namespace}, e.serverSideArgs(true)...))
+	fmt.Fprint(e.out(), RedactSecretDiff(output))
+	return err
+}
+
+func (e *kubectlEngine) out() io.Writer {
+	if e.options.Out == nil {
+		return os.Stdout
+	}
+	return e.options.Out
+}
+
+// Conflicts returns the field ownership conflicts a server-side apply of the manifest runs into; client-side apply has no conflicts
+func (e *kubectlEngine) Conflicts(ctx context.Context, manifestPath string) ([]string, error) {
+	if !e.options.ServerSide {
+		return nil, nil
+	}
+
+	output, err := e.output(ctx, append([]string{"apply", "-f", manifestPath, "-n", e.options.Namespace, "--dry-run=server"}, e.serverSideArgs(false)...))
+	if err == nil {
+		return nil, nil
+	}
+	if !strings.Contains(output, "conflict") {
+		return nil, fmt.Errorf("%w with output %v", err, output)
+	}
+
+	// keep the conflict messages and drop the advice kubectl prints after them
+	conflicts := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Please review the fields above") {
+			break
+		}
+		if line != "" {
+			conflicts = append(conflicts, strings.TrimPrefix(line, "error: "))
+		}
+	}
+
+	return conflicts, nil
+}
+
+func (e *kubectlEngine) Apply(ctx context.Context, manifestPath string) error {
+	return e.run(ctx, append([]string{"apply", "-f", manifestPath, "-n", e.options.Namespace}, e.serverSideArgs(e.options.ForceConflicts)...))
+}
+
+func (e *kubectlEngine) serverSideArgs(forceConflicts bool) []string {
+	if !e.options.ServerSide {
+		return nil
+	}
+	args := []string{"--server-side", "--field-manager=" + fieldManager}
+	if forceConflicts {
+		args = append(args, "--force-conflicts")
+	}
+	return args
+}
+
+func (e *kubectlEngine) Label(ctx context.Context, manifestPath string, labels []string) error {
+	return e.run(ctx, append([]string{"label", "-f", manifestPath, "-n", e.options.Namespace, "--overwrite"}, labels...))
+}
+
+func (e *kubectlEngine) Delete(ctx context.Context, manifestPath string, dryRun bool) error {
+	args := []string{"delete", "-f", manifestPath, "-n", e.options.Namespace}
+	if dryRun {
+		args = append(args, "--dry-run=server")
+	}
+	return e.run(ctx, args)
+}
+
+func (e *kubectlEngine) AwaitEstablished(ctx context.Context, crdName string) error {
+	return e.run(ctx, []string{"wait", "--for=condition=Established", "customresourcedefinition/" + crdName, fmt.Sprintf("--timeout=%v", crdEstablishedTimeout)})
+}
+
+func (e *kubectlEngine) RolloutStatus(ctx context.Context, kind, name string) error {
+	return e.run(ctx, []string{"rollout", "status", kind, name, "-n", e.options.Namespace})
+}
+
+// RolloutRevision returns the latest revision in the rollout history, or 0 if the workload doesn't exist yet
+func (e *kubectlEngine) RolloutRevision(ctx context.Context, kind, name string) (int64, error) {
+	revisions, err := e.rolloutHistory(ctx, kind, name)
+	if err != nil {
+		return 0, err
+	}
+	if len(revisions) == 0 {
+		return 0, nil
+	}
+
+	return revisions[len(revisions)-1], nil
+}
+
+// RolloutUndo rolls back to the revision before the latest one in the rollout history
+func (e *kubectlEngine) RolloutUndo(ctx context.Context, kind, name string) (revision int64, err error) {
+	revisions, err := e.rolloutHistory(ctx, kind, name)
+	if err != nil {
+		return 0, err
+	}
+	if len(revisions) < 2 {
+		return 0, fmt.Errorf("%v %v has no previous revision to roll back to", kind, name)
+	}
+	revision = revisions[len(revisions)-2]
+
+	err = e.run(ctx, []string{"rollout", "undo", kind, name, "-n", e.options.Namespace, fmt.Sprintf("--to-revision=%v", revision)})
+	if err != nil {
+		return 0, err
+	}
+
+	return revision, nil
+}
+
+// rolloutHistory returns the revisions of the workload, oldest first, or none if it doesn't exist
+func (e *kubectlEngine) rolloutHistory(ctx context.Context, kind, name string) ([]int64, error) {
+	output, err := e.output(ctx, []string{"rollout", "history", kind, name, "-n", e.options.Namespace})
+	if err != nil {
+		if strings.Contains(output, "NotFound") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w with output %v", err, output)
+	}
+
+	// the history lists one revision per line after the REVISION header
+	revisions := []int64{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if r, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+			revisions = append(revisions, r)
+		}
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i] < revisions[j] })
+
+	return revisions, nil
+}
+
+func (e *kubectlEngine) LabelWorkload(ctx context.Context, kind, name string, labels []string) error {
+	return e.run(ctx, append([]string{"label", kind, name, "-n", e.options.Namespace, "--overwrite"}, labels...))
+}
+
+func (e *kubectlEngine) GetDeploymentReplicas(ctx context.Context, name string) (replicas int, exists bool, err error) {
+	output, err := e.output(ctx, []string{"get", "deployment", name, "-n", e.options.Namespace, "-o=jsonpath='{.spec.replicas}'"})
+	if err != nil {
+		if strings.Contains(output, "NotFound") {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("%w with output %v", err, output)
+	}
+
+	output = strings.Trim(output, "'")
+
+	replicas, err = strconv.Atoi(output)
+	if err != nil {
+		return 0, true, fmt.Errorf("%w with output %v", err, output)
+	}
+
+	return replicas, true, nil
+}
+
+func (e *kubectlEngine) JobSucceeded(ctx context.Context, name string) (bool, error) {
+	output, _ := e.output(ctx, []string{"get", "job", name, "-n", e.options.Namespace, "-o", "jsonpath='{.status.succeeded}'"})
+
+	return strings.Compare(output, "'1'") == 0, nil
+}
+
+func (e *kubectlEngine) DescribeJob(ctx context.Context, name string) (description, logs string) {
+	description, _ = e.output(ctx, []string{"describe", "job", name, "-n", e.options.Namespace})
+	logs, _ = e.output(ctx, []string{"logs", "job/" + name, "-n", e.options.Namespace})
+
+	return
+}
+
+// ListObjects lists the objects of all namespaced kinds that match the label selector
+func (e *kubectlEngine) ListObjects(ctx context.Context, labelSelector string) ([]LiveObject, error) {
+	output, err := e.output(ctx, []string{"api-resources", "--verbs=list,delete", "--namespaced", "-o", "name"})
+	if err != nil {
+		return nil, fmt.Errorf("%w with output %v", err, output)
+	}
+	resources := strings.Fields(output)
+	if len(resources) == 0 {
+		return []LiveObject{}, nil
+	}
+
+	output, err = e.output(ctx, []string{"get", strings.Join(resources, ","), "-l", labelSelector, "-n", e.options.Namespace, "-o", "custom-columns=APIVERSION:.apiVersion,KIND:.kind,NAME:.metadata.name,OWNER:.metadata.ownerReferences[0].kind", "--no-headers", "--ignore-not-found"})
+	if err != nil {
+		return nil, fmt.Errorf("%w with output %v", err, output)
+	}
+
+	objects := []LiveObject{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			continue
+		}
+		group, version := "", fields[0]
+		if i := strings.Index(fields[0], "/"); i >= 0 {
+			group, version = fields[0][:i], fields[0][i+1:]
+		}
+		// custom-columns prints <none> for objects without owner
+		objects = append(objects, LiveObject{Group: group, Version: version, Kind: fields[1], Name: fields[2], Owned: fields[3] != "<none>"})
+	}
+
+	return objects, nil
+}
+
+func (e *kubectlEngine) DeleteObject(ctx context.Context, obj LiveObject) error {
+	return e.run(ctx, []string{"delete", obj.String(), "-n", e.options.Namespace})
+}
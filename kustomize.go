@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// BuildKustomization builds the kustomization in dir in-process and returns the resulting manifest; if renderer is set every file is rendered before kustomize reads it
+func BuildKustomization(dir string, renderer Renderer) ([]byte, error) {
+
+	var fSys filesys.FileSystem = filesys.MakeFsOnDisk()
+	if renderer != nil {
+		fSys = &renderingFileSystem{FileSystem: fSys, renderer: renderer}
+	}
+
+	resources, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(fSys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("Failed building kustomization %v: %w", dir, err)
+	}
+
+	manifest, err := resources.AsYaml()
+	if err != nil {
+		return nil, fmt.Errorf("Failed converting kustomization %v to yaml: %w", dir, err)
+	}
+
+	return manifest, nil
+}
+
+// renderingFileSystem renders files when they're read, so placeholders can be used in kustomizations and their resources
+type renderingFileSystem struct {
+	filesys.FileSystem
+	renderer Renderer
+}
+
+func (fs *renderingFileSystem) ReadFile(path string) ([]byte, error) {
+	content, err := fs.FileSystem.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered, err := fs.renderer.Render(path, content)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(rendered), nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestKustomization(t *testing.T) string {
+	dir := t.TempDir()
+	files := map[string]string{
+		"base/kustomization.yaml":       "resources:\n- configmap.yaml\n",
+		"base/configmap.yaml":           "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: myconfig\ndata:\n  version: ${VERSION}\n",
+		"overlay/kustomization.yaml":    "resources:\n- ../base\nnamePrefix: ${PREFIX}-\n",
+		"overlay/unused-file-here.yaml": "not: used\n",
+	}
+	for f, content := range files {
+		p := filepath.Join(dir, f)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(p), 0777))
+		assert.Nil(t, ioutil.WriteFile(p, []byte(content), 0666))
+	}
+	return dir
+}
+
+func TestBuildKustomization(t *testing.T) {
+
+	t.Run("BuildsOverlayWithoutRenderingIfRendererIsNil", func(t *testing.T) {
+
+		dir := createTestKustomization(t)
+
+		// act
+		manifest, err := BuildKustomization(filepath.Join(dir, "overlay"), nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "apiVersion: v1\ndata:\n  version: ${VERSION}\nkind: ConfigMap\nmetadata:\n  name: ${PREFIX}-myconfig\n", string(manifest))
+	})
+
+	t.Run("RendersAllFilesBeforeBuildingIfRendererIsSet", func(t *testing.T) {
+
+		dir := createTestKustomization(t)
+		renderer, _ := NewRenderer(Params{Placeholders: map[string]string{"VERSION": "1.0.3", "PREFIX": "prod"}}, nil)
+
+		// act
+		manifest, err := BuildKustomization(filepath.Join(dir, "overlay"), renderer)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "apiVersion: v1\ndata:\n  version: 1.0.3\nkind: ConfigMap\nmetadata:\n  name: prod-myconfig\n", string(manifest))
+	})
+
+	t.Run("ReturnsErrorIfDirectoryHasNoKustomization", func(t *testing.T) {
+
+		// act
+		_, err := BuildKustomization(t.TempDir(), nil)
+
+		assert.NotNil(t, err)
+	})
+}
@@ -3,20 +3,13 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
-	"os"
-	"path/filepath"
 	"runtime"
-	"strconv"
-	"strings"
-	"time"
 
 	"github.com/estafette/estafette-extension-gke/api"
 	foundation "github.com/estafette/estafette-foundation"
 	"github.com/rs/zerolog/log"
 	"gopkg.in/alecthomas/kingpin.v2"
-	"gopkg.in/yaml.v2"
 )
 
 var (
@@ -87,69 +80,17 @@ func main() {
 		}
 	}
 
-	log.Info().Msgf("Checking if credential %v exists...", credentialsParam.Credentials)
-	credential := GetCredentialsByName(credentials, credentialsParam.Credentials)
-	if credential == nil {
-		log.Fatal().Msgf("Credential with name %v does not exist.", credentialsParam.Credentials)
-	}
-
-	var params Params
-	if credential.AdditionalProperties.Defaults != nil {
-		log.Info().Msgf("Using defaults from credential %v...", credentialsParam.Credentials)
-		params = *credential.AdditionalProperties.Defaults
-	}
-
-	log.Info().Msg("Unmarshalling parameters / custom properties...")
-	err = yaml.Unmarshal([]byte(*paramsYAML), &params)
+	log.Info().Msg("Resolving credentials...")
+	selectedCredentials, err := credentialsParam.ResolveCredentials(credentials)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed unmarshalling parameters")
+		log.Fatal().Err(err).Msg("Failed resolving credentials")
 	}
 
-	log.Info().Msg("Setting defaults for parameters that are not set in the manifest...")
-	params.SetDefaults()
-
-	log.Info().Msg("Retrieving service account email from credentials...")
-	var keyFileMap map[string]interface{}
-	err = json.Unmarshal([]byte(credential.AdditionalProperties.ServiceAccountKeyfile), &keyFileMap)
+	log.Info().Msg("Validating credentials...")
+	err = ValidateCredentials(selectedCredentials)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed unmarshalling service account keyfile")
-	}
-	var saClientEmail string
-	if saClientEmailIntfc, ok := keyFileMap["client_email"]; !ok {
-		log.Fatal().Msg("Field client_email missing from service account keyfile")
-	} else {
-		if t, aok := saClientEmailIntfc.(string); !aok {
-			log.Fatal().Msg("Field client_email not of type string")
-		} else {
-			saClientEmail = t
-		}
-	}
-
-	log.Info().Msgf("Storing gke credential %v on disk...", credentialsParam.Credentials)
-	err = ioutil.WriteFile("/key-file.json", []byte(credential.AdditionalProperties.ServiceAccountKeyfile), 0600)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed writing service account keyfile")
-	}
-
-	log.Info().Msg("Authenticating to google cloud")
-	foundation.RunCommandWithArgs(ctx, "gcloud", []string{"auth", "activate-service-account", saClientEmail, "--key-file", "/key-file.json"})
-
-	log.Info().Msgf("Setting gcloud account to %v", saClientEmail)
-	foundation.RunCommandWithArgs(ctx, "gcloud", []string{"config", "set", "account", saClientEmail})
-
-	log.Info().Msg("Setting gcloud project")
-	foundation.RunCommandWithArgs(ctx, "gcloud", []string{"config", "set", "project", credential.AdditionalProperties.Project})
-
-	log.Info().Msgf("Getting gke credentials for cluster %v", credential.AdditionalProperties.Cluster)
-	clustersGetCredentialsArsgs := []string{"container", "clusters", "get-credentials", credential.AdditionalProperties.Cluster}
-	if credential.AdditionalProperties.Zone != "" {
-		clustersGetCredentialsArsgs = append(clustersGetCredentialsArsgs, "--zone", credential.AdditionalProperties.Zone)
-	} else if credential.AdditionalProperties.Region != "" {
-		clustersGetCredentialsArsgs = append(clustersGetCredentialsArsgs, "--region", credential.AdditionalProperties.Region)
-	} else {
-		log.Fatal().Msg("Credentials have no zone or region; at least one of them has to be defined")
+		log.Fatal().Err(err).Msg("Invalid credentials")
 	}
-	foundation.RunCommandWithArgs(ctx, "gcloud", clustersGetCredentialsArsgs)
 
 	if *builderImageSHA != "" {
 		// grab only first 20 char of hash since it is not necessary to go beyond that
@@ -161,211 +102,20 @@ func main() {
 			*builderImageDate = api.SanitizeLabel(builderImageDateTrimmed)
 		}
 	}
-	// create 'rendered' directory
-	renderedDir, err := ioutil.TempDir("", "rendered-*")
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed creating a temporary directory for rendered manifests")
-	}
 
-	defer os.RemoveAll(renderedDir)
-
-	// check if manifests exists
-	for _, m := range params.Manifests {
-		if _, err := os.Stat(m); os.IsNotExist(err) {
-			log.Fatal().Msgf("Manifest %v does not exist", m)
-		}
-
-		// read file
-		manifestContent, err := ioutil.ReadFile(m)
+	deployers := []*Deployer{}
+	for _, credential := range selectedCredentials {
+		log.Info().Msgf("Setting parameters for credential %v...", credential.Name)
+		params, err := NewClusterParams(credential, *paramsYAML)
 		if err != nil {
-			log.Fatal().Err(err).Msgf("Can't read manifest %v", m)
+			log.Fatal().Err(err).Msgf("Failed setting parameters for credential %v", credential.Name)
 		}
 
-		// 'render' with placeholders
-		renderedManifestContent := os.Expand(string(manifestContent), func(placeholderName string) string {
-
-			if placeholderValue, ok := params.Placeholders[placeholderName]; ok {
-				return placeholderValue
-			}
-
-			return fmt.Sprintf("$%v", placeholderName)
-		})
-
-		// create directory in case manifest file is not in root of repo
-		renderedFilepath := filepath.Join(renderedDir, m)
-		renderedFileDir := filepath.Dir(renderedFilepath)
-		err = os.MkdirAll(renderedFileDir, 0666)
-		if err != nil {
-			log.Fatal().Err(err).Msgf("Failed creating directory '%v'", renderedFileDir)
-		}
-
-		// store rendered manifest
-		err = ioutil.WriteFile(renderedFilepath, []byte(renderedManifestContent), 0666)
-		if err != nil {
-			log.Fatal().Err(err).Msgf("Failed writing manifest to '%v'", renderedFilepath)
-		}
-
-		log.Debug().Msgf("\n%v:\n", m)
-		log.Debug().Msgf("%v\n", renderedManifestContent)
-	}
-
-	if *releaseAction == "delete" {
-		// dry-run manifests
-		log.Info().Msg("\nDRYRUN\n")
-		for _, m := range params.Manifests {
-			kubectlDeleteArgs := []string{"delete", "-f", filepath.Join(renderedDir, m), "-n", params.Namespace}
-
-			foundation.RunCommandWithArgs(ctx, "kubectl", append(kubectlDeleteArgs, "--dry-run=server"))
-		}
-
-		if params.DryRun {
-			return
-		}
-
-		log.Info().Msg("\nDELETE\n")
-
-		// delete resources
-		for _, m := range params.Manifests {
-			kubectlDeleteArgs := []string{"delete", "-f", filepath.Join(renderedDir, m), "-n", params.Namespace}
-
-			// delete resources from manifest
-			log.Info().Msgf("Deleting resources defined in the manifest '%v'...", m)
-			foundation.RunCommandWithArgs(ctx, "kubectl", kubectlDeleteArgs)
-		}
-
-		return
-	}
-
-	// dry-run manifests
-	log.Info().Msg("\nDRYRUN\n")
-	for _, m := range params.Manifests {
-		kubectlApplyArgs := []string{"apply", "-f", filepath.Join(renderedDir, m), "-n", params.Namespace}
-
-		// always perform a dryrun to ensure we're not ending up in a semi broken state where half of the templates is successfully applied and others not
-		foundation.RunCommandWithArgs(ctx, "kubectl", append(kubectlApplyArgs, "--dry-run=server"))
+		deployers = append(deployers, NewDeployer(NewCommandExecutor(), credential, params, *releaseAction, *builderImageSHA, *builderImageDate))
 	}
 
-	log.Info().Msg("\nDIFF\n")
-	for _, m := range params.Manifests {
-		kubectlApplyArgs := []string{"diff", "-f", filepath.Join(renderedDir, m), "-n", params.Namespace}
-
-		// always perform a dryrun to ensure we're not ending up in a semi broken state where half of the templates is successfully applied and others not
-		_ = foundation.RunCommandWithArgsExtended(ctx, "kubectl", kubectlApplyArgs)
-	}
-
-	if params.DryRun || *releaseAction == "diff" {
-		return
-	}
-
-	if params.AwaitZeroReplicas {
-		for _, deploy := range params.Deployments {
-			log.Info().Msgf("Awaiting for deployment '%v' to scale to 0 replicas...", deploy)
-			for {
-				output, err := foundation.GetCommandWithArgsOutput(ctx, "kubectl", []string{"get", "deployment", deploy, "-n", params.Namespace, "-o=jsonpath='{.spec.replicas}'"})
-				if err != nil {
-					if strings.Contains(output, "NotFound") {
-						// this is the first time it gets deployed, so nothing to wait for
-						log.Warn().Msgf("Deployment '%v' does not exist yet, no need to wait", deploy)
-						break
-					}
-					log.Fatal().Err(err).Str("output", output).Msgf("Failed retrieving replicas for deployment '%v'", deploy)
-				}
-
-				output = strings.Trim(output, "'")
-
-				replicas, err := strconv.Atoi(output)
-				if err != nil {
-					log.Fatal().Err(err).Str("output", output).Msgf("Failed converting replicas to integer for deployment '%v'", deploy)
-				}
-
-				if replicas == 0 {
-					break
-				}
-
-				log.Info().Msgf("Deployment '%v' has %v replicas; sleeping for 10 seconds", deploy, replicas)
-				time.Sleep(10 * time.Second)
-			}
-
-			log.Info().Msgf("Deployment '%v' has scaled to 0 replicas...", deploy)
-		}
-	}
-
-	log.Info().Msg("\nAPPLY\n")
-
-	// apply manifests
-	for _, m := range params.Manifests {
-		kubectlApplyArgs := []string{"apply", "-f", filepath.Join(renderedDir, m), "-n", params.Namespace}
-
-		// apply manifest for real
-		log.Info().Msgf("Applying manifest '%v'...", m)
-		foundation.RunCommandWithArgs(ctx, "kubectl", kubectlApplyArgs)
-
-		// add labels to the resources of the file
-		err = foundation.RunCommandWithArgsExtended(ctx, "kubectl", []string{"label", "-f", filepath.Join(renderedDir, m), "-n", params.Namespace, "--overwrite", fmt.Sprintf("estafette.io/builder-image-sha=%v", *builderImageSHA), fmt.Sprintf("estafette.io/builder-image-date=%v", *builderImageDate), "app.kubernetes.io/managed-by=estafette-extension-gke-yaml"})
-
-		if err != nil {
-			log.Error().Msgf("Error with labeling resources in file %v with error: %v", filepath.Join(renderedDir, m), err)
-		}
-	}
-
-	for _, deploy := range params.Deployments {
-		log.Info().Msgf("Waiting for deployment '%v' to finish...", deploy)
-		err = foundation.RunCommandWithArgsExtended(ctx, "kubectl", []string{"rollout", "status", "deployment", deploy, "-n", params.Namespace})
-		if err != nil {
-			log.Error().Msgf("Error with rolling out deployment %v with error: %v", deploy, err)
-		}
-		err = foundation.RunCommandWithArgsExtended(ctx, "kubectl", []string{"label", "deployment", deploy, "-n", params.Namespace, "--overwrite", fmt.Sprintf("estafette.io/builder-image-sha=%v", *builderImageSHA), fmt.Sprintf("estafette.io/builder-image-date=%v", *builderImageDate), "app.kubernetes.io/managed-by=estafette-extension-gke-yaml"})
-		if err != nil {
-			log.Error().Msgf("Error with labeling deployment %v with error: %v", deploy, err)
-		}
-	}
-
-	for _, sts := range params.Statefulsets {
-		log.Info().Msgf("Waiting for statefulset '%v' to finish...", sts)
-		err = foundation.RunCommandWithArgsExtended(ctx, "kubectl", []string{"rollout", "status", "statefulset", sts, "-n", params.Namespace})
-		if err != nil {
-			log.Error().Msgf("Error with rolling out statefulset %v with error: %v", sts, err)
-		}
-		err = foundation.RunCommandWithArgsExtended(ctx, "kubectl", []string{"label", "statefulset", sts, "-n", params.Namespace, "--overwrite", fmt.Sprintf("estafette.io/builder-image-sha=%v", *builderImageSHA), fmt.Sprintf("estafette.io/builder-image-date=%v", *builderImageDate), "app.kubernetes.io/managed-by=estafette-extension-gke-yaml"})
-		if err != nil {
-			log.Error().Msgf("Error with labeling statefulset %v with error: %v", sts, err)
-		}
-	}
-
-	for _, ds := range params.Daemonsets {
-		log.Info().Msgf("Waiting for daemonsets '%v' to finish...", ds)
-		err = foundation.RunCommandWithArgsExtended(ctx, "kubectl", []string{"rollout", "status", "daemonsets", ds, "-n", params.Namespace})
-		if err != nil {
-			log.Error().Msgf("Error with rooling out daemonset %v with error: %v", ds, err)
-		}
-		err = foundation.RunCommandWithArgsExtended(ctx, "kubectl", []string{"label", "daemonset", ds, "-n", params.Namespace, "--overwrite", fmt.Sprintf("estafette.io/builder-image-sha=%v", *builderImageSHA), fmt.Sprintf("estafette.io/builder-image-date=%v", *builderImageDate), "app.kubernetes.io/managed-by=estafette-extension-gke-yaml"})
-		if err != nil {
-			log.Error().Msgf("Error with labeling daemonset %v with error: %v", ds, err)
-		}
-	}
-
-	if params.JobTimeoutSeconds > 0 {
-		timeoutChan := time.After(time.Second * time.Duration(params.JobTimeoutSeconds))
-		for _, job := range params.Jobs {
-			log.Info().Msgf("Waiting for job '%v' to finish...", job)
-		JobWaitLoop:
-			for {
-				select {
-				default:
-					out, _ := foundation.GetCommandWithArgsOutput(ctx, "kubectl", []string{"get", "job", job, "-n", params.Namespace, "-o", "jsonpath='{.status.succeeded}'"})
-					if strings.Compare(out, "'1'") == 0 {
-						log.Info().Msgf("Job '%v' finished successfully.", job)
-						break JobWaitLoop
-					} else {
-						time.Sleep(time.Second * 2)
-					}
-				case <-timeoutChan:
-					desc, _ := foundation.GetCommandWithArgsOutput(ctx, "kubectl", []string{"describe", "job", job, "-n", params.Namespace})
-					logs, _ := foundation.GetCommandWithArgsOutput(ctx, "kubectl", []string{"logs", "job/" + job, "-n", params.Namespace})
-					log.Fatal().Msgf("Job '%v' timed-out.\nJob Describe:\n%s\n\n\nLogs:\n%s", job, desc, logs)
-				}
-			}
-		}
+	err = ReleaseToClusters(ctx, deployers, credentialsParam.ParallelClusters)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed releasing manifests")
 	}
-
 }
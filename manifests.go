@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ExpandManifests resolves the manifests parameter into a list of files; entries can be files, directories (all yaml files below it) or glob patterns where ** matches any number of directories.
+// Files are returned in the order of the entries and sorted by path within an entry, without duplicates and without files matching one of the exclude patterns.
+func ExpandManifests(manifests, excludes []string) ([]string, error) {
+
+	files := []string{}
+	seen := map[string]bool{}
+
+	for _, m := range manifests {
+		matches, err := expandManifest(m)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, match := range matches {
+			if seen[match] || isExcluded(match, excludes) {
+				continue
+			}
+			seen[match] = true
+			files = append(files, match)
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("Manifests %v do not contain any file after applying exclusions %v", manifests, excludes)
+	}
+
+	return files, nil
+}
+
+func expandManifest(manifest string) ([]string, error) {
+
+	manifest = filepath.ToSlash(filepath.Clean(manifest))
+
+	if !hasGlobMeta(manifest) {
+		info, err := os.Stat(manifest)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("Manifest %v does not exist", manifest)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return []string{manifest}, nil
+		}
+
+		matches, err := walkManifests(manifest, func(p string) bool {
+			return strings.HasSuffix(p, ".yaml") || strings.HasSuffix(p, ".yml")
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("Manifest directory %v does not contain any .yaml or .yml files", manifest)
+		}
+		return matches, nil
+	}
+
+	// walk from the deepest directory without glob characters
+	segments := strings.Split(manifest, "/")
+	baseSegments := []string{}
+	for _, s := range segments {
+		if hasGlobMeta(s) {
+			break
+		}
+		baseSegments = append(baseSegments, s)
+	}
+	base := strings.Join(baseSegments, "/")
+	if base == "" && strings.HasPrefix(manifest, "/") {
+		base = "/"
+	} else if base == "" {
+		base = "."
+	}
+
+	if _, err := os.Stat(base); os.IsNotExist(err) {
+		return nil, fmt.Errorf("Manifest pattern %v does not match any file", manifest)
+	}
+
+	matches, err := walkManifests(base, func(p string) bool {
+		return matchPath(manifest, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("Manifest pattern %v does not match any file", manifest)
+	}
+
+	return matches, nil
+}
+
+func walkManifests(root string, include func(p string) bool) ([]string, error) {
+	matches := []string{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		p = filepath.ToSlash(p)
+		if include(p) {
+			matches = append(matches, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(matches)
+
+	return matches, nil
+}
+
+func isExcluded(file string, excludes []string) bool {
+	for _, e := range excludes {
+		if matchPath(filepath.ToSlash(filepath.Clean(e)), file) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath reports whether a slash separated path matches the pattern, where ** matches zero or more directories
+func matchPath(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if matched, err := path.Match(pattern[0], name[0]); err != nil || !matched {
+			return false
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+
+	return len(name) == 0
+}
+
+func hasGlobMeta(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestManifests(t *testing.T, files ...string) string {
+	dir := t.TempDir()
+	for _, f := range files {
+		p := filepath.Join(dir, f)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(p), 0777))
+		assert.Nil(t, ioutil.WriteFile(p, []byte("kind: ConfigMap\n"), 0666))
+	}
+	return filepath.ToSlash(dir)
+}
+
+func TestExpandManifests(t *testing.T) {
+
+	t.Run("ReturnsFilesInOrderOfEntries", func(t *testing.T) {
+
+		dir := createTestManifests(t, "kubernetes.yaml", "service.yaml")
+
+		// act
+		manifests, err := ExpandManifests([]string{dir + "/service.yaml", dir + "/kubernetes.yaml"}, nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{dir + "/service.yaml", dir + "/kubernetes.yaml"}, manifests)
+	})
+
+	t.Run("ReturnsAllYamlFilesBelowDirectorySortedByPath", func(t *testing.T) {
+
+		dir := createTestManifests(t, "k8s/service.yaml", "k8s/deployment.yml", "k8s/base/namespace.yaml", "k8s/README.md")
+
+		// act
+		manifests, err := ExpandManifests([]string{dir + "/k8s"}, nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{dir + "/k8s/base/namespace.yaml", dir + "/k8s/deployment.yml", dir + "/k8s/service.yaml"}, manifests)
+	})
+
+	t.Run("ReturnsFilesMatchingDoubleStarPatternInAnyDirectory", func(t *testing.T) {
+
+		dir := createTestManifests(t, "k8s/service.yaml", "k8s/a/b/deployment.yaml", "k8s/a/config.json", "other/ingress.yaml")
+
+		// act
+		manifests, err := ExpandManifests([]string{dir + "/k8s/**/*.yaml"}, nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{dir + "/k8s/a/b/deployment.yaml", dir + "/k8s/service.yaml"}, manifests)
+	})
+
+	t.Run("ExcludesFilesMatchingExcludePatternsAndDuplicates", func(t *testing.T) {
+
+		dir := createTestManifests(t, "k8s/namespace.yaml", "k8s/service.yaml", "k8s/test/job.yaml")
+
+		// act
+		manifests, err := ExpandManifests([]string{dir + "/k8s/namespace.yaml", dir + "/k8s"}, []string{dir + "/k8s/test/**"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{dir + "/k8s/namespace.yaml", dir + "/k8s/service.yaml"}, manifests)
+	})
+
+	t.Run("ReturnsErrorIfPatternMatchesNothing", func(t *testing.T) {
+
+		dir := createTestManifests(t, "k8s/service.yaml")
+
+		// act
+		_, err := ExpandManifests([]string{dir + "/k8s/*.json"}, nil)
+
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "does not match any file")
+	})
+
+	t.Run("ReturnsErrorIfFileDoesNotExist", func(t *testing.T) {
+
+		dir := createTestManifests(t)
+
+		// act
+		_, err := ExpandManifests([]string{dir + "/kubernetes.yaml"}, nil)
+
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "does not exist")
+	})
+}
+
+func TestMatchPath(t *testing.T) {
+
+	t.Run("MatchesDoubleStarAgainstZeroOrMoreDirectories", func(t *testing.T) {
+
+		assert.True(t, matchPath("k8s/**/*.yaml", "k8s/service.yaml"))
+		assert.True(t, matchPath("k8s/**/*.yaml", "k8s/a/b/service.yaml"))
+		assert.False(t, matchPath("k8s/**/*.yaml", "other/service.yaml"))
+		assert.False(t, matchPath("k8s/*.yaml", "k8s/a/service.yaml"))
+	})
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	sourceCredentialDefaults  = "credential defaults"
+	sourceStage               = "stage"
+	sourceClusterPlaceholders = "cluster placeholders"
+	sourcePlaceholderFiles    = "placeholder files"
+	sourceDefault             = "default"
+)
+
+// MergeParams merges the params set in the stage into the defaults of a credential, field by field:
+// maps are merged key by key with the stage winning, lists tagged with merge:"append" are appended to the defaults and all other fields are replaced, but only if the stage sets them.
+// It returns the merged params and the sources of the values per param, keyed by yaml name.
+func MergeParams(defaults *Params, stage Params, stageKeys []string) (Params, map[string]string) {
+
+	var merged Params
+	if defaults != nil {
+		merged = *defaults
+	}
+
+	sources := map[string]string{}
+	mergedValue := reflect.ValueOf(&merged).Elem()
+	stageValue := reflect.ValueOf(stage)
+	t := mergedValue.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		key := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		field := mergedValue.Field(i)
+		stageField := stageValue.Field(i)
+
+		if !containsString(stageKeys, key) {
+			if !field.IsZero() {
+				sources[key] = sourceCredentialDefaults
+			}
+			continue
+		}
+
+		if !field.IsZero() && !stageField.IsZero() {
+			switch {
+			// merge into new maps and lists, so the credential defaults stay the same for the next cluster
+			case field.Kind() == reflect.Map:
+				mergedMap := reflect.MakeMap(field.Type())
+				for _, m := range []reflect.Value{field, stageField} {
+					for _, k := range m.MapKeys() {
+						mergedMap.SetMapIndex(k, m.MapIndex(k))
+					}
+				}
+				field.Set(mergedMap)
+				sources[key] = sourceCredentialDefaults + " and " + sourceStage
+				continue
+			case field.Kind() == reflect.Slice && t.Field(i).Tag.Get("merge") == "append":
+				mergedSlice := reflect.MakeSlice(field.Type(), 0, field.Len()+stageField.Len())
+				field.Set(reflect.AppendSlice(reflect.AppendSlice(mergedSlice, field), stageField))
+				sources[key] = sourceCredentialDefaults + " and " + sourceStage
+				continue
+			}
+		}
+
+		field.Set(stageField)
+		sources[key] = sourceStage
+	}
+
+	return merged, sources
+}
+
+// setDefaultsWithSources sets the defaults of the params and records them as source of the params that only got a value from them
+func setDefaultsWithSources(params *Params, sources map[string]string) {
+
+	before := *params
+	params.SetDefaults()
+
+	beforeValue := reflect.ValueOf(before)
+	afterValue := reflect.ValueOf(*params)
+	t := afterValue.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if beforeValue.Field(i).IsZero() && !afterValue.Field(i).IsZero() {
+			sources[strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]] = sourceDefault
+		}
+	}
+}
+
+// effectiveParams returns a line per param that has a value, with the value and where it came from; the values of placeholders from files, listed with the file they came from, are never logged
+func effectiveParams(params Params, sources map[string]string, placeholderFiles map[string]string) string {
+
+	params.Placeholders = maskPlaceholders(params.Placeholders, params.SensitivePlaceholders, placeholderFiles)
+	if params.ClusterPlaceholders != nil {
+		clusterPlaceholders := map[string]map[string]string{}
+		for cluster, placeholders := range params.ClusterPlaceholders {
+			clusterPlaceholders[cluster] = maskPlaceholders(placeholders, params.SensitivePlaceholders, nil)
+		}
+		params.ClusterPlaceholders = clusterPlaceholders
+	}
+
+	value := reflect.ValueOf(params)
+	t := value.Type()
+
+	lines := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		if value.Field(i).IsZero() {
+			continue
+		}
+		key := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		v, err := json.Marshal(value.Field(i).Interface())
+		if err != nil {
+			v = []byte(fmt.Sprintf("%v", value.Field(i).Interface()))
+		}
+		lines = append(lines, fmt.Sprintf("%v: %s (%v)", key, v, sources[key]))
+	}
+	sort.Strings(lines)
+
+	return strings.Join(lines, "\n")
+}
+
+// maskPlaceholders returns a copy of the placeholders with the values of sensitive and secret looking ones masked, and those from files replaced by the file they came from
+func maskPlaceholders(placeholders map[string]string, sensitive []string, files map[string]string) map[string]string {
+	if placeholders == nil {
+		return nil
+	}
+
+	masked := map[string]string{}
+	for k, v := range placeholders {
+		if file, ok := files[k]; ok {
+			masked[k] = fmt.Sprintf("%v (from %v)", redactedValue, file)
+			continue
+		}
+		masked[k] = maskSecretLooking(k, v, sensitive)
+	}
+
+	return masked
+}
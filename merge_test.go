@@ -0,0 +1,124 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeParams(t *testing.T) {
+
+	t.Run("MergesMapsKeyByKeyAppendsTaggedListsAndReplacesOtherFields", func(t *testing.T) {
+
+		defaults := &Params{
+			Manifests:        []string{"k8s/base.yaml"},
+			ExcludeManifests: []string{"k8s/test/**"},
+			Placeholders:     map[string]string{"REGION": "europe-west1", "REPLICAS": "2"},
+			Namespace:        "default-namespace",
+			DryRun:           true,
+		}
+		stage := Params{
+			Manifests:        []string{"k8s/app.yaml"},
+			ExcludeManifests: []string{"k8s/local/**"},
+			Placeholders:     map[string]string{"REPLICAS": "3"},
+			DryRun:           false,
+		}
+
+		// act
+		params, sources := MergeParams(defaults, stage, []string{"dryrun", "excludeManifests", "manifests", "placeholders"})
+
+		assert.Equal(t, []string{"k8s/app.yaml"}, params.Manifests)
+		assert.Equal(t, []string{"k8s/test/**", "k8s/local/**"}, params.ExcludeManifests)
+		assert.Equal(t, map[string]string{"REGION": "europe-west1", "REPLICAS": "3"}, params.Placeholders)
+		assert.Equal(t, "default-namespace", params.Namespace)
+		assert.False(t, params.DryRun)
+		assert.Equal(t, map[string]string{
+			"manifests":        "stage",
+			"excludeManifests": "credential defaults and stage",
+			"placeholders":     "credential defaults and stage",
+			"namespace":        "credential defaults",
+			"dryrun":           "stage",
+		}, sources)
+	})
+
+	t.Run("AppendsEveryTaggedListToDefaults", func(t *testing.T) {
+
+		defaults := &Params{
+			ExcludeManifests:        []string{"k8s/test/**"},
+			ChartValues:             []string{"values.yaml"},
+			PlaceholderAllowlist:    []string{"TRACE_ID"},
+			EnvironmentPlaceholders: []string{"ESTAFETTE_BUILD_VERSION"},
+			SensitivePlaceholders:   []string{"API_KEY"},
+			PlaceholderFiles:        []string{"config/defaults.yaml"},
+		}
+		stage := Params{
+			ExcludeManifests:        []string{"k8s/local/**"},
+			ChartValues:             []string{"values-production.yaml"},
+			PlaceholderAllowlist:    []string{"SPAN_ID"},
+			EnvironmentPlaceholders: []string{"ESTAFETTE_GIT_BRANCH"},
+			SensitivePlaceholders:   []string{"DB_PASSWORD"},
+			PlaceholderFiles:        []string{"config/production.yaml"},
+		}
+
+		// act
+		params, _ := MergeParams(defaults, stage, []string{"excludeManifests", "chartValues", "placeholderAllowlist", "environmentPlaceholders", "sensitivePlaceholders", "placeholderFiles"})
+
+		assert.Equal(t, []string{"k8s/test/**", "k8s/local/**"}, params.ExcludeManifests)
+		assert.Equal(t, []string{"values.yaml", "values-production.yaml"}, params.ChartValues)
+		assert.Equal(t, []string{"TRACE_ID", "SPAN_ID"}, params.PlaceholderAllowlist)
+		assert.Equal(t, []string{"ESTAFETTE_BUILD_VERSION", "ESTAFETTE_GIT_BRANCH"}, params.EnvironmentPlaceholders)
+		assert.Equal(t, []string{"API_KEY", "DB_PASSWORD"}, params.SensitivePlaceholders)
+		assert.Equal(t, []string{"config/defaults.yaml", "config/production.yaml"}, params.PlaceholderFiles)
+	})
+
+	t.Run("DoesNotChangeDefaults", func(t *testing.T) {
+
+		defaults := &Params{
+			ExcludeManifests: make([]string, 1, 10),
+			Placeholders:     map[string]string{"REGION": "europe-west1"},
+		}
+
+		// act
+		_, _ = MergeParams(defaults, Params{ExcludeManifests: []string{"k8s/local/**"}, Placeholders: map[string]string{"REGION": "us-central1"}}, []string{"excludeManifests", "placeholders"})
+
+		assert.Equal(t, 1, len(defaults.ExcludeManifests))
+		assert.Equal(t, map[string]string{"REGION": "europe-west1"}, defaults.Placeholders)
+	})
+
+	t.Run("ReturnsStageParamsIfThereAreNoDefaults", func(t *testing.T) {
+
+		stage := Params{Namespace: "mynamespace"}
+
+		// act
+		params, sources := MergeParams(nil, stage, []string{"namespace"})
+
+		assert.Equal(t, stage, params)
+		assert.Equal(t, map[string]string{"namespace": "stage"}, sources)
+	})
+}
+
+func TestEffectiveParams(t *testing.T) {
+
+	t.Run("ReturnsValueAndSourceOfParamsWithValue", func(t *testing.T) {
+
+		params := Params{Namespace: "mynamespace"}
+		sources := map[string]string{"namespace": "stage"}
+		setDefaultsWithSources(&params, sources)
+
+		// act
+		lines := effectiveParams(params, sources, nil)
+
+		assert.Equal(t, "engine: \"kubectl\" (default)\nmanifests: [\"kubernetes.yaml\"] (default)\nnamespace: \"mynamespace\" (stage)\nrenderer: \"placeholders\" (default)", lines)
+	})
+	t.Run("MasksValuesOfSensitiveAndSecretLookingPlaceholders", func(t *testing.T) {
+
+		params := Params{Placeholders: map[string]string{"DB_URL": "postgres://user:s3cr3t@db", "API_TOKEN": "t0k3n", "VERSION": "1.0.3"}, SensitivePlaceholders: []string{"DB_*"}}
+
+		// act
+		lines := effectiveParams(params, map[string]string{}, nil)
+
+		assert.Contains(t, lines, `placeholders: {"API_TOKEN":"***","DB_URL":"***","VERSION":"1.0.3"}`)
+		assert.NotContains(t, lines, "s3cr3t")
+		assert.NotContains(t, lines, "t0k3n")
+	})
+}
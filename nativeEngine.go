@@ -0,0 +1,838 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/yaml"
+)
+
+// revisionAnnotation holds the revision of a deployment and its replicasets
+const revisionAnnotation = "deployment.kubernetes.io/revision"
+
+// fieldManager is the name under which the native engine owns the fields it applies
+const fieldManager = "estafette-gke-yaml"
+
+// NewNativeEngineFromKubeconfig returns an Engine that uses the kubernetes api directly, with the kubeconfig of the options written by gcloud container clusters get-credentials
+func NewNativeEngineFromKubeconfig(options EngineOptions) (Engine, error) {
+
+	restConfig, clientConfig, err := restConfigFromKubeconfig(options)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := options.Namespace
+	if namespace == "" {
+		namespace, _, err = clientConfig.Namespace()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(clientset.Discovery()))
+
+	e := newNativeEngine(dynamicClient, clientset, mapper, namespace)
+	e.forceConflicts = options.ForceConflicts
+	if options.Out != nil {
+		e.out = options.Out
+	}
+
+	return e, nil
+}
+
+// restConfigFromKubeconfig loads the context of the kubeconfig; the exec credential plugin gets the env of the options, since client-go runs it with the env of this process, which lacks the gcloud config of the session
+func restConfigFromKubeconfig(options EngineOptions) (*rest.Config, clientcmd.ClientConfig, error) {
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = options.Kubeconfig
+
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{CurrentContext: options.Context})
+
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if restConfig.ExecProvider != nil {
+		for _, e := range options.Env {
+			keyValue := strings.SplitN(e, "=", 2)
+			if len(keyValue) != 2 {
+				continue
+			}
+			restConfig.ExecProvider.Env = append(restConfig.ExecProvider.Env, clientcmdapi.ExecEnvVar{Name: keyValue[0], Value: keyValue[1]})
+		}
+	}
+
+	return restConfig, clientConfig, nil
+}
+
+func newNativeEngine(dynamicClient dynamic.Interface, clientset kubernetes.Interface, mapper meta.RESTMapper, namespace string) *nativeEngine {
+	return &nativeEngine{
+		dynamicClient: dynamicClient,
+		clientset:     clientset,
+		mapper:        mapper,
+		namespace:     namespace,
+		out:           os.Stdout,
+		pollInterval:  2 * time.Second,
+	}
+}
+
+type nativeEngine struct {
+	dynamicClient  dynamic.Interface
+	clientset      kubernetes.Interface
+	mapper         meta.RESTMapper
+	namespace      string
+	forceConflicts bool
+	out            io.Writer
+	pollInterval   time.Duration
+}
+
+func (e *nativeEngine) DryRun(ctx context.Context, manifestPath string) error {
+	return e.forEachObject(ctx, manifestPath, "dry-run", func(obj *unstructured.Unstructured, resource dynamic.ResourceInterface, description string) error {
+		_, result, err := e.apply(ctx, obj, resource, true, true)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(e.out, "%v %v (server dry run)\n", description, result)
+		return nil
+	})
+}
+
+func (e *nativeEngine) Diff(ctx context.Context, manifestPath string) error {
+	return e.forEachObject(ctx, manifestPath, "diff", func(obj *unstructured.Unstructured, resource dynamic.ResourceInterface, description string) error {
+		live, err := resource.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			fmt.Fprintf(e.out, "error: %v: %v\n", description, err)
+			return err
+		}
+
+		merged, _, err := e.apply(ctx, obj, resource, true, true)
+		if err != nil {
+			fmt.Fprintf(e.out, "error: %v: %v\n", description, err)
+			return err
+		}
+
+		RedactSecretObjects(live, merged)
+
+		liveYAML, err := diffableYAML(live)
+		if err != nil {
+			return err
+		}
+		mergedYAML, err := diffableYAML(merged)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprint(e.out, unifiedDiff("live/"+description, "merged/"+description, liveYAML, mergedYAML))
+		return nil
+	})
+}
+
+func (e *nativeEngine) Apply(ctx context.Context, manifestPath string) error {
+	return e.forEachObject(ctx, manifestPath, "apply", func(obj *unstructured.Unstructured, resource dynamic.ResourceInterface, description string) error {
+		_, result, err := e.apply(ctx, obj, resource, false, e.forceConflicts)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(e.out, "%v %v\n", description, result)
+		return nil
+	})
+}
+
+// Conflicts returns the field ownership conflicts applying the manifest without force runs into
+func (e *nativeEngine) Conflicts(ctx context.Context, manifestPath string) ([]string, error) {
+	conflicts := []string{}
+	err := e.forEachObject(ctx, manifestPath, "conflicts", func(obj *unstructured.Unstructured, resource dynamic.ResourceInterface, description string) error {
+		_, _, err := e.apply(ctx, obj, resource, true, false)
+		if apierrors.IsConflict(err) {
+			conflicts = append(conflicts, fmt.Sprintf("%v: %v", description, err))
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return conflicts, nil
+}
+
+func (e *nativeEngine) Label(ctx context.Context, manifestPath string, labels []string) error {
+	patch, err := labelsPatch(labels)
+	if err != nil {
+		return err
+	}
+
+	return e.forEachObject(ctx, manifestPath, "label", func(obj *unstructured.Unstructured, resource dynamic.ResourceInterface, description string) error {
+		_, err := resource.Patch(ctx, obj.GetName(), types.MergePatchType, patch, metav1.PatchOptions{FieldManager: fieldManager})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(e.out, "%v labeled\n", description)
+		return nil
+	})
+}
+
+func (e *nativeEngine) Delete(ctx context.Context, manifestPath string, dryRun bool) error {
+	propagationPolicy := metav1.DeletePropagationBackground
+
+	return e.forEachObject(ctx, manifestPath, "delete", func(obj *unstructured.Unstructured, resource dynamic.ResourceInterface, description string) error {
+		err := resource.Delete(ctx, obj.GetName(), metav1.DeleteOptions{DryRun: dryRunOption(dryRun), PropagationPolicy: &propagationPolicy})
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			fmt.Fprintf(e.out, "%v deleted (server dry run)\n", description)
+		} else {
+			fmt.Fprintf(e.out, "%v deleted\n", description)
+		}
+		return nil
+	})
+}
+
+// AwaitEstablished polls the crd until its Established condition is true and resets the cached discovery, so its kind can be mapped
+func (e *nativeEngine) AwaitEstablished(ctx context.Context, crdName string) error {
+	ctx, cancel := context.WithTimeout(ctx, crdEstablishedTimeout)
+	defer cancel()
+
+	crds := e.dynamicClient.Resource(schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"})
+	for {
+		crd, err := crds.Get(ctx, crdName, metav1.GetOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return &ObjectError{Operation: "wait", Kind: "CustomResourceDefinition", Name: crdName, Err: err}
+		}
+		if err == nil && isEstablished(crd) {
+			if resettableMapper, ok := e.mapper.(meta.ResettableRESTMapper); ok {
+				resettableMapper.Reset()
+			}
+			fmt.Fprintf(e.out, "customresourcedefinition.apiextensions.k8s.io/%v condition met\n", crdName)
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return &ObjectError{Operation: "wait", Kind: "CustomResourceDefinition", Name: crdName, Err: ctx.Err()}
+		case <-time.After(e.pollInterval):
+		}
+	}
+}
+
+func isEstablished(crd *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if ok && condition["type"] == "Established" && condition["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *nativeEngine) RolloutStatus(ctx context.Context, kind, name string) error {
+	lastMessage := ""
+	for {
+		done, message, err := e.rolloutStatus(ctx, kind, name)
+		if err != nil {
+			return &ObjectError{Operation: "rollout", Kind: kind, Namespace: e.namespace, Name: name, Err: err}
+		}
+		if done {
+			fmt.Fprintf(e.out, "%v %q successfully rolled out\n", kind, name)
+			return nil
+		}
+		if message != lastMessage {
+			fmt.Fprintln(e.out, message)
+			lastMessage = message
+		}
+
+		select {
+		case <-ctx.Done():
+			return &ObjectError{Operation: "rollout", Kind: kind, Namespace: e.namespace, Name: name, Err: ctx.Err()}
+		case <-time.After(e.pollInterval):
+		}
+	}
+}
+
+// RolloutRevision returns the current revision of the workload, or 0 if it doesn't exist yet
+func (e *nativeEngine) RolloutRevision(ctx context.Context, kind, name string) (revision int64, err error) {
+	switch kind {
+	case "deployment":
+		var deployment *appsv1.Deployment
+		deployment, err = e.clientset.AppsV1().Deployments(e.namespace).Get(ctx, name, metav1.GetOptions{})
+		if err == nil {
+			revision, _ = strconv.ParseInt(deployment.Annotations[revisionAnnotation], 10, 64)
+		}
+	case "statefulset", "daemonset":
+		var owned []appsv1.ControllerRevision
+		owned, err = e.controllerRevisions(ctx, kind, name)
+		if err == nil && len(owned) > 0 {
+			revision = owned[len(owned)-1].Revision
+		}
+	default:
+		err = fmt.Errorf("kind %v is not supported", kind)
+	}
+	if apierrors.IsNotFound(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, &ObjectError{Operation: "revision", Kind: kind, Namespace: e.namespace, Name: name, Err: err}
+	}
+
+	return revision, nil
+}
+
+// RolloutUndo rolls back to the revision before the latest one, like kubectl rollout undo
+func (e *nativeEngine) RolloutUndo(ctx context.Context, kind, name string) (revision int64, err error) {
+	switch kind {
+	case "deployment":
+		revision, err = e.undoDeployment(ctx, name)
+	case "statefulset", "daemonset":
+		revision, err = e.undoControllerRevision(ctx, kind, name)
+	default:
+		err = fmt.Errorf("kind %v is not supported", kind)
+	}
+	if err != nil {
+		return 0, &ObjectError{Operation: "rollback", Kind: kind, Namespace: e.namespace, Name: name, Err: err}
+	}
+
+	fmt.Fprintf(e.out, "%v %q rolled back to revision %v\n", kind, name, revision)
+
+	return revision, nil
+}
+
+// undoDeployment restores the pod template of the replicaset with the highest revision before the current one
+func (e *nativeEngine) undoDeployment(ctx context.Context, name string) (int64, error) {
+	deployment, err := e.clientset.AppsV1().Deployments(e.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+	current, _ := strconv.ParseInt(deployment.Annotations[revisionAnnotation], 10, 64)
+
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return 0, err
+	}
+	replicaSets, err := e.clientset.AppsV1().ReplicaSets(e.namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return 0, err
+	}
+
+	var previous *appsv1.ReplicaSet
+	var previousRevision int64
+	for i, rs := range replicaSets.Items {
+		if !metav1.IsControlledBy(&replicaSets.Items[i], deployment) {
+			continue
+		}
+		r, err := strconv.ParseInt(rs.Annotations[revisionAnnotation], 10, 64)
+		if err != nil || r >= current || r <= previousRevision {
+			continue
+		}
+		previous = &replicaSets.Items[i]
+		previousRevision = r
+	}
+	if previous == nil {
+		return 0, errors.New("no previous revision to roll back to")
+	}
+
+	template := previous.Spec.Template.DeepCopy()
+	delete(template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+	patch, err := json.Marshal([]map[string]interface{}{{"op": "replace", "path": "/spec/template", "value": template}})
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = e.clientset.AppsV1().Deployments(e.namespace).Patch(ctx, name, types.JSONPatchType, patch, metav1.PatchOptions{FieldManager: fieldManager})
+	if err != nil {
+		return 0, err
+	}
+
+	return previousRevision, nil
+}
+
+// undoControllerRevision applies the controller revision before the latest one of a statefulset or daemonset, which is stored as patch of its pod template
+func (e *nativeEngine) undoControllerRevision(ctx context.Context, kind, name string) (int64, error) {
+	owned, err := e.controllerRevisions(ctx, kind, name)
+	if err != nil {
+		return 0, err
+	}
+	if len(owned) < 2 {
+		return 0, errors.New("no previous revision to roll back to")
+	}
+	previous := owned[len(owned)-2]
+
+	switch kind {
+	case "statefulset":
+		_, err = e.clientset.AppsV1().StatefulSets(e.namespace).Patch(ctx, name, types.StrategicMergePatchType, previous.Data.Raw, metav1.PatchOptions{FieldManager: fieldManager})
+	case "daemonset":
+		_, err = e.clientset.AppsV1().DaemonSets(e.namespace).Patch(ctx, name, types.StrategicMergePatchType, previous.Data.Raw, metav1.PatchOptions{FieldManager: fieldManager})
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return previous.Revision, nil
+}
+
+// controllerRevisions returns the controller revisions of a statefulset or daemonset, oldest first
+func (e *nativeEngine) controllerRevisions(ctx context.Context, kind, name string) ([]appsv1.ControllerRevision, error) {
+	var owner metav1.Object
+	var labelSelector *metav1.LabelSelector
+	switch kind {
+	case "statefulset":
+		statefulset, err := e.clientset.AppsV1().StatefulSets(e.namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		owner, labelSelector = statefulset, statefulset.Spec.Selector
+	case "daemonset":
+		daemonset, err := e.clientset.AppsV1().DaemonSets(e.namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		owner, labelSelector = daemonset, daemonset.Spec.Selector
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return nil, err
+	}
+	controllerRevisions, err := e.clientset.AppsV1().ControllerRevisions(e.namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	owned := []appsv1.ControllerRevision{}
+	for i := range controllerRevisions.Items {
+		if metav1.IsControlledBy(&controllerRevisions.Items[i], owner) {
+			owned = append(owned, controllerRevisions.Items[i])
+		}
+	}
+	sort.Slice(owned, func(i, j int) bool { return owned[i].Revision < owned[j].Revision })
+
+	return owned, nil
+}
+
+func (e *nativeEngine) LabelWorkload(ctx context.Context, kind, name string, labels []string) (err error) {
+	patch, err := labelsPatch(labels)
+	if err != nil {
+		return err
+	}
+
+	switch kind {
+	case "deployment":
+		_, err = e.clientset.AppsV1().Deployments(e.namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: fieldManager})
+	case "statefulset":
+		_, err = e.clientset.AppsV1().StatefulSets(e.namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: fieldManager})
+	case "daemonset":
+		_, err = e.clientset.AppsV1().DaemonSets(e.namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: fieldManager})
+	default:
+		err = fmt.Errorf("kind %v is not supported", kind)
+	}
+	if err != nil {
+		return &ObjectError{Operation: "label", Kind: kind, Namespace: e.namespace, Name: name, Err: err}
+	}
+
+	return nil
+}
+
+func (e *nativeEngine) GetDeploymentReplicas(ctx context.Context, name string) (replicas int, exists bool, err error) {
+	deployment, err := e.clientset.AppsV1().Deployments(e.namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, &ObjectError{Operation: "get", Kind: "deployment", Namespace: e.namespace, Name: name, Err: err}
+	}
+
+	if deployment.Spec.Replicas == nil {
+		return 1, true, nil
+	}
+
+	return int(*deployment.Spec.Replicas), true, nil
+}
+
+func (e *nativeEngine) JobSucceeded(ctx context.Context, name string) (bool, error) {
+	job, err := e.clientset.BatchV1().Jobs(e.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return false, &ObjectError{Operation: "get", Kind: "job", Namespace: e.namespace, Name: name, Err: err}
+	}
+
+	return job.Status.Succeeded > 0, nil
+}
+
+func (e *nativeEngine) DescribeJob(ctx context.Context, name string) (description, logs string) {
+	job, err := e.clientset.BatchV1().Jobs(e.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err.Error(), ""
+	}
+	statusYAML, err := yaml.Marshal(job.Status)
+	if err != nil {
+		return err.Error(), ""
+	}
+	description = string(statusYAML)
+
+	pods, err := e.clientset.CoreV1().Pods(e.namespace).List(ctx, metav1.ListOptions{LabelSelector: "job-name=" + name})
+	if err != nil {
+		return description, err.Error()
+	}
+	var sb strings.Builder
+	for _, pod := range pods.Items {
+		podLogs, err := e.clientset.CoreV1().Pods(e.namespace).GetLogs(pod.Name, nil).DoRaw(ctx)
+		if err != nil {
+			sb.WriteString(fmt.Sprintf("%v: %v\n", pod.Name, err))
+			continue
+		}
+		sb.Write(podLogs)
+	}
+
+	return description, sb.String()
+}
+
+// ListObjects lists the objects of all namespaced kinds that match the label selector
+func (e *nativeEngine) ListObjects(ctx context.Context, labelSelector string) ([]LiveObject, error) {
+	resourceLists, err := discovery.ServerPreferredNamespacedResources(e.clientset.Discovery())
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, err
+	}
+	resourceLists = discovery.FilteredBy(discovery.SupportsAllVerbs{Verbs: []string{"list", "delete"}}, resourceLists)
+
+	objects := []LiveObject{}
+	for _, resourceList := range resourceLists {
+		gv, err := schema.ParseGroupVersion(resourceList.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range resourceList.APIResources {
+			if strings.Contains(r.Name, "/") {
+				// skip subresources
+				continue
+			}
+			list, err := e.dynamicClient.Resource(gv.WithResource(r.Name)).Namespace(e.namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+			if err != nil {
+				return nil, &ObjectError{Operation: "list", Kind: r.Kind, Namespace: e.namespace, Name: labelSelector, Err: err}
+			}
+			for _, item := range list.Items {
+				objects = append(objects, LiveObject{Group: gv.Group, Version: gv.Version, Kind: r.Kind, Name: item.GetName(), Owned: len(item.GetOwnerReferences()) > 0})
+			}
+		}
+	}
+
+	return objects, nil
+}
+
+func (e *nativeEngine) DeleteObject(ctx context.Context, obj LiveObject) error {
+	mapping, err := e.mapper.RESTMapping(schema.GroupKind{Group: obj.Group, Kind: obj.Kind}, obj.Version)
+	if err != nil {
+		return &ObjectError{Operation: "delete", Kind: obj.Kind, Namespace: e.namespace, Name: obj.Name, Err: err}
+	}
+
+	err = e.dynamicClient.Resource(mapping.Resource).Namespace(e.namespace).Delete(ctx, obj.Name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return &ObjectError{Operation: "delete", Kind: obj.Kind, Namespace: e.namespace, Name: obj.Name, Err: err}
+	}
+
+	fmt.Fprintf(e.out, "%v deleted\n", obj)
+
+	return nil
+}
+
+// forEachObject runs the operation for all objects in a manifest file and returns an ObjectError for every object it fails for
+func (e *nativeEngine) forEachObject(ctx context.Context, manifestPath, operation string, fn func(obj *unstructured.Unstructured, resource dynamic.ResourceInterface, description string) error) error {
+	objects, err := readObjects(manifestPath)
+	if err != nil {
+		return err
+	}
+
+	objectErrors := []error{}
+	for _, obj := range objects {
+		resource, description, err := e.resourceFor(obj)
+		if err == nil {
+			err = fn(obj, resource, description)
+		}
+		if err != nil {
+			objectErrors = append(objectErrors, &ObjectError{Operation: operation, Kind: obj.GetKind(), Namespace: obj.GetNamespace(), Name: obj.GetName(), Err: err})
+		}
+	}
+
+	return errors.Join(objectErrors...)
+}
+
+// resourceFor returns the client for the object's resource and a kubectl style description of the object; it defaults the namespace of namespaced objects to the engine's namespace
+func (e *nativeEngine) resourceFor(obj *unstructured.Unstructured) (dynamic.ResourceInterface, string, error) {
+	gvk := obj.GroupVersionKind()
+	mapping, err := e.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		// the kind might be defined by a crd that has been applied after discovery was cached
+		if resettableMapper, ok := e.mapper.(meta.ResettableRESTMapper); ok {
+			resettableMapper.Reset()
+			mapping, err = e.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		}
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	description := mapping.Resource.Resource
+	if mapping.Resource.Group != "" {
+		description += "." + mapping.Resource.Group
+	}
+	description += "/" + obj.GetName()
+
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return e.dynamicClient.Resource(mapping.Resource), description, nil
+	}
+
+	if obj.GetNamespace() == "" {
+		obj.SetNamespace(e.namespace)
+	} else if e.namespace != "" && obj.GetNamespace() != e.namespace {
+		return nil, "", fmt.Errorf("the namespace from the provided object %q does not match the namespace %q", obj.GetNamespace(), e.namespace)
+	}
+
+	return e.dynamicClient.Resource(mapping.Resource).Namespace(obj.GetNamespace()), description, nil
+}
+
+// apply creates the object if it doesn't exist yet and server-side applies it otherwise; it returns the resulting object and what happened in kubectl's wording
+func (e *nativeEngine) apply(ctx context.Context, obj *unstructured.Unstructured, resource dynamic.ResourceInterface, dryRun, force bool) (*unstructured.Unstructured, string, error) {
+	// the apply patch creates objects that don't exist as well, so all fields stay owned by the apply manager; the get only tells which of the two it was
+	action := "configured"
+	_, err := resource.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		action = "created"
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	data, err := obj.MarshalJSON()
+	if err != nil {
+		return nil, "", err
+	}
+
+	result, err := resource.Patch(ctx, obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{FieldManager: fieldManager, Force: &force, DryRun: dryRunOption(dryRun)})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return result, action, nil
+}
+
+func (e *nativeEngine) rolloutStatus(ctx context.Context, kind, name string) (done bool, message string, err error) {
+	switch kind {
+	case "deployment":
+		deployment, err := e.clientset.AppsV1().Deployments(e.namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, "", err
+		}
+		return deploymentRolloutStatus(deployment)
+	case "statefulset":
+		statefulset, err := e.clientset.AppsV1().StatefulSets(e.namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, "", err
+		}
+		return statefulsetRolloutStatus(statefulset)
+	case "daemonset":
+		daemonset, err := e.clientset.AppsV1().DaemonSets(e.namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, "", err
+		}
+		return daemonsetRolloutStatus(daemonset)
+	}
+
+	return false, "", fmt.Errorf("kind %v is not supported", kind)
+}
+
+// deploymentRolloutStatus mirrors the checks of kubectl rollout status for deployments
+func deploymentRolloutStatus(deployment *appsv1.Deployment) (done bool, message string, err error) {
+	if deployment.Generation > deployment.Status.ObservedGeneration {
+		return false, "Waiting for deployment spec update to be observed...", nil
+	}
+
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+			return false, "", fmt.Errorf("deployment %q exceeded its progress deadline", deployment.Name)
+		}
+	}
+
+	if deployment.Spec.Replicas != nil && deployment.Status.UpdatedReplicas < *deployment.Spec.Replicas {
+		return false, fmt.Sprintf("Waiting for deployment %q rollout to finish: %d out of %d new replicas have been updated...", deployment.Name, deployment.Status.UpdatedReplicas, *deployment.Spec.Replicas), nil
+	}
+	if deployment.Status.Replicas > deployment.Status.UpdatedReplicas {
+		return false, fmt.Sprintf("Waiting for deployment %q rollout to finish: %d old replicas are pending termination...", deployment.Name, deployment.Status.Replicas-deployment.Status.UpdatedReplicas), nil
+	}
+	if deployment.Status.AvailableReplicas < deployment.Status.UpdatedReplicas {
+		return false, fmt.Sprintf("Waiting for deployment %q rollout to finish: %d of %d updated replicas are available...", deployment.Name, deployment.Status.AvailableReplicas, deployment.Status.UpdatedReplicas), nil
+	}
+
+	return true, "", nil
+}
+
+// statefulsetRolloutStatus mirrors the checks of kubectl rollout status for statefulsets
+func statefulsetRolloutStatus(statefulset *appsv1.StatefulSet) (done bool, message string, err error) {
+	if statefulset.Spec.UpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType {
+		return false, "", fmt.Errorf("rollout status is only available for %s strategy type", appsv1.RollingUpdateStatefulSetStrategyType)
+	}
+	if statefulset.Status.ObservedGeneration == 0 || statefulset.Generation > statefulset.Status.ObservedGeneration {
+		return false, "Waiting for statefulset spec update to be observed...", nil
+	}
+	if statefulset.Spec.Replicas != nil && statefulset.Status.ReadyReplicas < *statefulset.Spec.Replicas {
+		return false, fmt.Sprintf("Waiting for %d pods to be ready...", *statefulset.Spec.Replicas-statefulset.Status.ReadyReplicas), nil
+	}
+	if statefulset.Spec.UpdateStrategy.RollingUpdate != nil && statefulset.Spec.UpdateStrategy.RollingUpdate.Partition != nil && *statefulset.Spec.UpdateStrategy.RollingUpdate.Partition > 0 {
+		if statefulset.Spec.Replicas != nil && statefulset.Status.UpdatedReplicas < *statefulset.Spec.Replicas-*statefulset.Spec.UpdateStrategy.RollingUpdate.Partition {
+			return false, fmt.Sprintf("Waiting for partitioned roll out to finish: %d out of %d new pods have been updated...", statefulset.Status.UpdatedReplicas, *statefulset.Spec.Replicas-*statefulset.Spec.UpdateStrategy.RollingUpdate.Partition), nil
+		}
+		return true, "", nil
+	}
+	if statefulset.Status.UpdateRevision != statefulset.Status.CurrentRevision {
+		return false, fmt.Sprintf("waiting for statefulset rolling update to complete %d pods at revision %s...", statefulset.Status.UpdatedReplicas, statefulset.Status.UpdateRevision), nil
+	}
+
+	return true, "", nil
+}
+
+// daemonsetRolloutStatus mirrors the checks of kubectl rollout status for daemonsets
+func daemonsetRolloutStatus(daemonset *appsv1.DaemonSet) (done bool, message string, err error) {
+	if daemonset.Spec.UpdateStrategy.Type != appsv1.RollingUpdateDaemonSetStrategyType {
+		return false, "", fmt.Errorf("rollout status is only available for %s strategy type", appsv1.RollingUpdateDaemonSetStrategyType)
+	}
+	if daemonset.Generation > daemonset.Status.ObservedGeneration {
+		return false, "Waiting for daemon set spec update to be observed...", nil
+	}
+	if daemonset.Status.UpdatedNumberScheduled < daemonset.Status.DesiredNumberScheduled {
+		return false, fmt.Sprintf("Waiting for daemon set %q rollout to finish: %d out of %d new pods have been updated...", daemonset.Name, daemonset.Status.UpdatedNumberScheduled, daemonset.Status.DesiredNumberScheduled), nil
+	}
+	if daemonset.Status.NumberAvailable < daemonset.Status.DesiredNumberScheduled {
+		return false, fmt.Sprintf("Waiting for daemon set %q rollout to finish: %d of %d updated pods are available...", daemonset.Name, daemonset.Status.NumberAvailable, daemonset.Status.DesiredNumberScheduled), nil
+	}
+
+	return true, "", nil
+}
+
+// readObjects parses all documents in a manifest file into objects, skipping empty documents and flattening lists
+func readObjects(manifestPath string) ([]*unstructured.Unstructured, error) {
+	manifestContent, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []*unstructured.Unstructured{}
+	reader := yamlutil.NewYAMLReader(bufio.NewReader(bytes.NewReader(manifestContent)))
+	for {
+		document, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed reading manifest %v: %w", manifestPath, err)
+		}
+
+		documentJSON, err := yaml.YAMLToJSON(document)
+		if err != nil {
+			return nil, fmt.Errorf("Failed parsing manifest %v: %w", manifestPath, err)
+		}
+		if trimmed := strings.TrimSpace(string(documentJSON)); trimmed == "null" || trimmed == "{}" {
+			continue
+		}
+
+		obj := &unstructured.Unstructured{}
+		err = obj.UnmarshalJSON(documentJSON)
+		if err != nil {
+			return nil, fmt.Errorf("Failed parsing manifest %v: %w", manifestPath, err)
+		}
+
+		if obj.IsList() {
+			err = obj.EachListItem(func(item runtime.Object) error {
+				objects = append(objects, item.(*unstructured.Unstructured))
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("Failed parsing manifest %v: %w", manifestPath, err)
+			}
+			continue
+		}
+
+		objects = append(objects, obj)
+	}
+
+	return objects, nil
+}
+
+// diffableYAML returns the object as yaml without the fields that change on every request
+func diffableYAML(obj *unstructured.Unstructured) (string, error) {
+	if obj == nil {
+		return "", nil
+	}
+
+	obj = obj.DeepCopy()
+	unstructured.RemoveNestedField(obj.Object, "status")
+	for _, field := range []string{"managedFields", "resourceVersion", "generation", "uid", "creationTimestamp"} {
+		unstructured.RemoveNestedField(obj.Object, "metadata", field)
+	}
+
+	data, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// labelsPatch turns key=value labels into a merge patch for the metadata of an object
+func labelsPatch(labels []string) ([]byte, error) {
+	labelsMap := map[string]string{}
+	for _, l := range labels {
+		keyValue := strings.SplitN(l, "=", 2)
+		if len(keyValue) != 2 {
+			return nil, fmt.Errorf("label %v is not of format key=value", l)
+		}
+		labelsMap[keyValue[0]] = keyValue[1]
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": labelsMap,
+		},
+	})
+}
+
+func dryRunOption(dryRun bool) []string {
+	if dryRun {
+		return []string{metav1.DryRunAll}
+	}
+	return nil
+}
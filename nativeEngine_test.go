@@ -0,0 +1,627 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubernetesfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func newTestNativeEngine(t *testing.T, objects ...runtime.Object) (*nativeEngine, *dynamicfake.FakeDynamicClient, *kubernetesfake.Clientset, *bytes.Buffer) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Secret"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), objects...)
+	clientset := kubernetesfake.NewSimpleClientset()
+
+	out := &bytes.Buffer{}
+	e := newNativeEngine(dynamicClient, clientset, mapper, "mynamespace")
+	e.out = out
+	e.pollInterval = time.Millisecond
+
+	return e, dynamicClient, clientset, out
+}
+
+// trackApplies makes the fake client handle apply patches like the api server does: objects that don't exist are created and
+// objects that weren't created by an apply conflict unless the apply is forced
+func trackApplies(dynamicClient *dynamicfake.FakeDynamicClient) {
+	applied := map[string]bool{}
+	dynamicClient.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patchAction := action.(k8stesting.PatchActionImpl)
+		if patchAction.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(patchAction.GetPatch()); err != nil {
+			return true, nil, err
+		}
+		obj.SetNamespace(patchAction.GetNamespace())
+		key := patchAction.GetResource().Resource + "/" + patchAction.GetNamespace() + "/" + patchAction.GetName()
+		tracker := dynamicClient.Tracker()
+		_, err := tracker.Get(patchAction.GetResource(), patchAction.GetNamespace(), patchAction.GetName())
+		switch {
+		case apierrors.IsNotFound(err):
+			err = tracker.Create(patchAction.GetResource(), obj, patchAction.GetNamespace())
+		case err != nil:
+		case !applied[key] && (patchAction.PatchOptions.Force == nil || !*patchAction.PatchOptions.Force):
+			err = apierrors.NewConflict(patchAction.GetResource().GroupResource(), patchAction.GetName(), errors.New(`conflict with "before-first-apply": .data`))
+		default:
+			err = tracker.Update(patchAction.GetResource(), obj, patchAction.GetNamespace())
+		}
+		if err != nil {
+			return true, nil, err
+		}
+		applied[key] = true
+
+		return true, obj, nil
+	})
+}
+
+func writeTestManifest(t *testing.T, content string) string {
+	manifestPath := filepath.Join(t.TempDir(), "kubernetes.yaml")
+	err := ioutil.WriteFile(manifestPath, []byte(content), 0666)
+	assert.Nil(t, err)
+
+	return manifestPath
+}
+
+func newTestConfigMap(name, value string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": "mynamespace",
+		},
+		"data": map[string]interface{}{
+			"key": value,
+		},
+	}}
+}
+
+func TestRestConfigFromKubeconfig(t *testing.T) {
+
+	t.Run("PassesEnvToExecCredentialPlugin", func(t *testing.T) {
+
+		kubeconfig := writeTestManifest(t, `apiVersion: v1
+kind: Config
+clusters:
+- name: gke_my-project_europe-west1-c_my-cluster
+  cluster:
+    server: https://10.0.0.1
+contexts:
+- name: gke_my-project_europe-west1-c_my-cluster
+  context:
+    cluster: gke_my-project_europe-west1-c_my-cluster
+    user: gke_my-project_europe-west1-c_my-cluster
+users:
+- name: gke_my-project_europe-west1-c_my-cluster
+  user:
+    exec:
+      apiVersion: client.authentication.k8s.io/v1beta1
+      command: gke-gcloud-auth-plugin
+      interactiveMode: IfAvailable
+      provideClusterInfo: true
+`)
+
+		// act
+		restConfig, _, err := restConfigFromKubeconfig(EngineOptions{Kubeconfig: kubeconfig, Context: "gke_my-project_europe-west1-c_my-cluster", Env: []string{"CLOUDSDK_CONFIG=/tmp/session-1/gcloud"}})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "gke-gcloud-auth-plugin", restConfig.ExecProvider.Command)
+		assert.Equal(t, []clientcmdapi.ExecEnvVar{{Name: "CLOUDSDK_CONFIG", Value: "/tmp/session-1/gcloud"}}, restConfig.ExecProvider.Env)
+	})
+}
+
+func TestNativeEngineApply(t *testing.T) {
+
+	t.Run("CreatesObjectsThatDoNotExistInEngineNamespace", func(t *testing.T) {
+
+		e, dynamicClient, _, out := newTestNativeEngine(t)
+		trackApplies(dynamicClient)
+		manifestPath := writeTestManifest(t, "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: mynamespace\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: myconfig\ndata:\n  key: value\n")
+
+		// act
+		err := e.Apply(context.Background(), manifestPath)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "namespaces/mynamespace created\nconfigmaps/myconfig created\n", out.String())
+
+		configMap, err := dynamicClient.Resource(schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}).Namespace("mynamespace").Get(context.Background(), "myconfig", metav1.GetOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, "mynamespace", configMap.GetNamespace())
+		patchAction := dynamicClient.Actions()[3].(k8stesting.PatchActionImpl)
+		assert.Equal(t, types.ApplyPatchType, patchAction.GetPatchType())
+	})
+
+	t.Run("ServerSideAppliesObjectsThatExist", func(t *testing.T) {
+
+		e, dynamicClient, _, out := newTestNativeEngine(t, newTestConfigMap("myconfig", "old"))
+		dynamicClient.PrependReactor("patch", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, newTestConfigMap("myconfig", "value"), nil
+		})
+		manifestPath := writeTestManifest(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: myconfig\ndata:\n  key: value\n")
+
+		// act
+		err := e.Apply(context.Background(), manifestPath)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "configmaps/myconfig configured\n", out.String())
+
+		patchAction := dynamicClient.Actions()[1].(k8stesting.PatchActionImpl)
+		assert.Equal(t, types.ApplyPatchType, patchAction.GetPatchType())
+	})
+
+	t.Run("AppliesChangedFieldsOfObjectItCreatedWithoutConflicts", func(t *testing.T) {
+
+		e, dynamicClient, _, out := newTestNativeEngine(t)
+		trackApplies(dynamicClient)
+
+		// act
+		err := e.Apply(context.Background(), writeTestManifest(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: myconfig\ndata:\n  image: myapp:1.0.0\n"))
+		assert.Nil(t, err)
+		err = e.Apply(context.Background(), writeTestManifest(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: myconfig\ndata:\n  image: myapp:1.0.1\n"))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "configmaps/myconfig created\nconfigmaps/myconfig configured\n", out.String())
+		configMap, err := dynamicClient.Resource(schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}).Namespace("mynamespace").Get(context.Background(), "myconfig", metav1.GetOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]interface{}{"image": "myapp:1.0.1"}, configMap.Object["data"])
+	})
+
+	t.Run("ReturnsObjectErrorForEveryFailingObject", func(t *testing.T) {
+
+		e, _, _, _ := newTestNativeEngine(t)
+		manifestPath := writeTestManifest(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: myconfig\n  namespace: othernamespace\n---\napiVersion: example.com/v1\nkind: Unknown\nmetadata:\n  name: myunknown\n")
+
+		// act
+		err := e.Apply(context.Background(), manifestPath)
+
+		assert.NotNil(t, err)
+		var objectError *ObjectError
+		assert.True(t, errors.As(err, &objectError))
+		assert.Equal(t, "apply", objectError.Operation)
+		assert.Equal(t, "ConfigMap", objectError.Kind)
+		assert.Equal(t, "myconfig", objectError.Name)
+		assert.Contains(t, err.Error(), "Unknown myunknown")
+	})
+}
+
+func TestNativeEngineDryRun(t *testing.T) {
+
+	t.Run("AppliesObjectsThatDoNotExistWithServerDryRun", func(t *testing.T) {
+
+		e, dynamicClient, _, out := newTestNativeEngine(t)
+		trackApplies(dynamicClient)
+		manifestPath := writeTestManifest(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: myconfig\ndata:\n  key: value\n")
+
+		// act
+		err := e.DryRun(context.Background(), manifestPath)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "configmaps/myconfig created (server dry run)\n", out.String())
+		patchAction := dynamicClient.Actions()[1].(k8stesting.PatchActionImpl)
+		assert.Equal(t, types.ApplyPatchType, patchAction.GetPatchType())
+	})
+}
+
+func TestNativeEngineDiff(t *testing.T) {
+
+	t.Run("PrintsDiffBetweenLiveAndMergedObject", func(t *testing.T) {
+
+		e, dynamicClient, _, out := newTestNativeEngine(t, newTestConfigMap("myconfig", "old"))
+		dynamicClient.PrependReactor("patch", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, newTestConfigMap("myconfig", "new"), nil
+		})
+		manifestPath := writeTestManifest(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: myconfig\ndata:\n  key: new\n")
+
+		// act
+		err := e.Diff(context.Background(), manifestPath)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "--- live/configmaps/myconfig\n+++ merged/configmaps/myconfig\n@@ -1,6 +1,6 @@\n apiVersion: v1\n data:\n-  key: old\n+  key: new\n kind: ConfigMap\n metadata:\n   name: myconfig\n", out.String())
+	})
+	t.Run("MasksValuesOfSecretsAndShowsChangedKeys", func(t *testing.T) {
+
+		live := &unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "Secret", "metadata": map[string]interface{}{"name": "mysecret", "namespace": "mynamespace"}, "data": map[string]interface{}{"password": "b2xk", "user": "YWRtaW4="}}}
+		e, dynamicClient, _, out := newTestNativeEngine(t, live)
+		dynamicClient.PrependReactor("patch", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, &unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "Secret", "metadata": map[string]interface{}{"name": "mysecret", "namespace": "mynamespace"}, "data": map[string]interface{}{"password": "bmV3", "token": "dDBrM24="}}}, nil
+		})
+		manifestPath := writeTestManifest(t, "apiVersion: v1\nkind: Secret\nmetadata:\n  name: mysecret\ndata:\n  password: bmV3\n  token: dDBrM24=\n")
+
+		// act
+		err := e.Diff(context.Background(), manifestPath)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "--- live/secrets/mysecret\n+++ merged/secrets/mysecret\n@@ -1,7 +1,7 @@\n apiVersion: v1\n data:\n-  password: '*** (before)'\n-  user: '***'\n+  password: '*** (after)'\n+  token: '***'\n kind: Secret\n metadata:\n   name: mysecret\n", out.String())
+		assert.NotContains(t, out.String(), "bmV3")
+	})
+}
+
+func TestNativeEngineConflicts(t *testing.T) {
+
+	t.Run("ReturnsConflictsOfApplyWithoutForce", func(t *testing.T) {
+
+		e, dynamicClient, _, _ := newTestNativeEngine(t, newTestConfigMap("myconfig", "old"))
+		dynamicClient.PrependReactor("patch", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, "myconfig", errors.New(`conflict with "kubectl-edit": .data.key`))
+		})
+		manifestPath := writeTestManifest(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: myconfig\ndata:\n  key: new\n")
+
+		// act
+		conflicts, err := e.Conflicts(context.Background(), manifestPath)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(conflicts))
+		assert.Contains(t, conflicts[0], `configmaps/myconfig: Operation cannot be fulfilled on configmaps "myconfig": conflict with "kubectl-edit": .data.key`)
+	})
+}
+
+func TestNativeEngineLabel(t *testing.T) {
+
+	t.Run("AddsLabelsToAllObjects", func(t *testing.T) {
+
+		e, dynamicClient, _, _ := newTestNativeEngine(t, newTestConfigMap("myconfig", "value"))
+		manifestPath := writeTestManifest(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: myconfig\n")
+
+		// act
+		err := e.Label(context.Background(), manifestPath, []string{"app.kubernetes.io/managed-by=estafette-extension-gke-yaml"})
+
+		assert.Nil(t, err)
+		configMap, err := dynamicClient.Resource(schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}).Namespace("mynamespace").Get(context.Background(), "myconfig", metav1.GetOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, "estafette-extension-gke-yaml", configMap.GetLabels()["app.kubernetes.io/managed-by"])
+	})
+}
+
+func TestNativeEngineDelete(t *testing.T) {
+
+	t.Run("DeletesAllObjects", func(t *testing.T) {
+
+		e, dynamicClient, _, out := newTestNativeEngine(t, newTestConfigMap("myconfig", "value"))
+		manifestPath := writeTestManifest(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: myconfig\n")
+
+		// act
+		err := e.Delete(context.Background(), manifestPath, false)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "configmaps/myconfig deleted\n", out.String())
+		assert.Equal(t, "delete", dynamicClient.Actions()[0].GetVerb())
+	})
+}
+
+func TestNativeEngineAwaitEstablished(t *testing.T) {
+
+	t.Run("ReturnsNilIfCrdIsEstablished", func(t *testing.T) {
+
+		crd := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apiextensions.k8s.io/v1",
+			"kind":       "CustomResourceDefinition",
+			"metadata":   map[string]interface{}{"name": "widgets.example.com"},
+			"status": map[string]interface{}{
+				"conditions": []interface{}{map[string]interface{}{"type": "Established", "status": "True"}},
+			},
+		}}
+		e, _, _, out := newTestNativeEngine(t, crd)
+
+		// act
+		err := e.AwaitEstablished(context.Background(), "widgets.example.com")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "customresourcedefinition.apiextensions.k8s.io/widgets.example.com condition met\n", out.String())
+	})
+
+	t.Run("ReturnsErrorIfContextIsCancelledBeforeCrdIsEstablished", func(t *testing.T) {
+
+		crd := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apiextensions.k8s.io/v1",
+			"kind":       "CustomResourceDefinition",
+			"metadata":   map[string]interface{}{"name": "widgets.example.com"},
+		}}
+		e, _, _, _ := newTestNativeEngine(t, crd)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		// act
+		err := e.AwaitEstablished(ctx, "widgets.example.com")
+
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	})
+}
+
+func TestNativeEngineRolloutStatus(t *testing.T) {
+
+	t.Run("ReturnsNilIfDeploymentIsRolledOut", func(t *testing.T) {
+
+		e, _, clientset, _ := newTestNativeEngine(t)
+		replicas := int32(2)
+		_, err := clientset.AppsV1().Deployments("mynamespace").Create(context.Background(), &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "mydeployment", Namespace: "mynamespace", Generation: 2},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+			Status:     appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2},
+		}, metav1.CreateOptions{})
+		assert.Nil(t, err)
+
+		// act
+		err = e.RolloutStatus(context.Background(), "deployment", "mydeployment")
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("ReturnsObjectErrorIfDeploymentExceededProgressDeadline", func(t *testing.T) {
+
+		e, _, clientset, _ := newTestNativeEngine(t)
+		_, err := clientset.AppsV1().Deployments("mynamespace").Create(context.Background(), &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "mydeployment", Namespace: "mynamespace"},
+			Status: appsv1.DeploymentStatus{Conditions: []appsv1.DeploymentCondition{
+				{Type: appsv1.DeploymentProgressing, Reason: "ProgressDeadlineExceeded"},
+			}},
+		}, metav1.CreateOptions{})
+		assert.Nil(t, err)
+
+		// act
+		err = e.RolloutStatus(context.Background(), "deployment", "mydeployment")
+
+		var objectError *ObjectError
+		assert.True(t, errors.As(err, &objectError))
+		assert.Equal(t, "rollout", objectError.Operation)
+	})
+
+	t.Run("ReturnsErrorIfContextIsCancelledBeforeRolloutFinishes", func(t *testing.T) {
+
+		e, _, clientset, _ := newTestNativeEngine(t)
+		_, err := clientset.AppsV1().DaemonSets("mynamespace").Create(context.Background(), &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "mydaemonset", Namespace: "mynamespace"},
+			Spec:       appsv1.DaemonSetSpec{UpdateStrategy: appsv1.DaemonSetUpdateStrategy{Type: appsv1.RollingUpdateDaemonSetStrategyType}},
+			Status:     appsv1.DaemonSetStatus{DesiredNumberScheduled: 3, UpdatedNumberScheduled: 1},
+		}, metav1.CreateOptions{})
+		assert.Nil(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		// act
+		err = e.RolloutStatus(ctx, "daemonset", "mydaemonset")
+
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	})
+}
+
+func TestStatefulsetRolloutStatus(t *testing.T) {
+
+	t.Run("ReturnsErrorIfUpdateStrategyIsOnDelete", func(t *testing.T) {
+
+		statefulset := &appsv1.StatefulSet{
+			Spec: appsv1.StatefulSetSpec{UpdateStrategy: appsv1.StatefulSetUpdateStrategy{Type: appsv1.OnDeleteStatefulSetStrategyType}},
+		}
+
+		// act
+		_, _, err := statefulsetRolloutStatus(statefulset)
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsNotDoneIfRevisionsDiffer", func(t *testing.T) {
+
+		replicas := int32(1)
+		statefulset := &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Generation: 1},
+			Spec:       appsv1.StatefulSetSpec{Replicas: &replicas, UpdateStrategy: appsv1.StatefulSetUpdateStrategy{Type: appsv1.RollingUpdateStatefulSetStrategyType}},
+			Status:     appsv1.StatefulSetStatus{ObservedGeneration: 1, ReadyReplicas: 1, CurrentRevision: "a", UpdateRevision: "b"},
+		}
+
+		// act
+		done, _, err := statefulsetRolloutStatus(statefulset)
+
+		assert.Nil(t, err)
+		assert.False(t, done)
+	})
+}
+
+func TestNativeEngineRolloutRevision(t *testing.T) {
+
+	t.Run("ReturnsRevisionOfDeployment", func(t *testing.T) {
+
+		e, _, clientset, _ := newTestNativeEngine(t)
+		_, err := clientset.AppsV1().Deployments("mynamespace").Create(context.Background(), &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "mydeployment", Namespace: "mynamespace", Annotations: map[string]string{revisionAnnotation: "3"}},
+		}, metav1.CreateOptions{})
+		assert.Nil(t, err)
+
+		// act
+		revision, err := e.RolloutRevision(context.Background(), "deployment", "mydeployment")
+
+		assert.Nil(t, err)
+		assert.Equal(t, int64(3), revision)
+	})
+
+	t.Run("ReturnsZeroIfWorkloadDoesNotExist", func(t *testing.T) {
+
+		e, _, _, _ := newTestNativeEngine(t)
+
+		// act
+		revision, err := e.RolloutRevision(context.Background(), "statefulset", "mystatefulset")
+
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), revision)
+	})
+}
+
+func TestNativeEngineRolloutUndo(t *testing.T) {
+
+	t.Run("RestoresPodTemplateOfPreviousReplicaSetOfDeployment", func(t *testing.T) {
+
+		e, _, clientset, _ := newTestNativeEngine(t)
+		ctx := context.Background()
+		controller := true
+		labels := map[string]string{"app": "myapp"}
+		deployment, err := clientset.AppsV1().Deployments("mynamespace").Create(ctx, &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "mydeployment", Namespace: "mynamespace", UID: "uid", Annotations: map[string]string{revisionAnnotation: "3"}},
+			Spec: appsv1.DeploymentSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: labels},
+				Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: labels}, Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "myapp", Image: "myapp:3"}}}},
+			},
+		}, metav1.CreateOptions{})
+		assert.Nil(t, err)
+		for _, revision := range []string{"1", "2", "3"} {
+			_, err := clientset.AppsV1().ReplicaSets("mynamespace").Create(ctx, &appsv1.ReplicaSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "mydeployment-" + revision,
+					Namespace:       "mynamespace",
+					Labels:          labels,
+					Annotations:     map[string]string{revisionAnnotation: revision},
+					OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "mydeployment", UID: deployment.UID, Controller: &controller}},
+				},
+				Spec: appsv1.ReplicaSetSpec{
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "myapp", appsv1.DefaultDeploymentUniqueLabelKey: "hash" + revision}},
+						Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "myapp", Image: "myapp:" + revision}}},
+					},
+				},
+			}, metav1.CreateOptions{})
+			assert.Nil(t, err)
+		}
+
+		// act
+		revision, err := e.RolloutUndo(ctx, "deployment", "mydeployment")
+
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), revision)
+		deployment, err = clientset.AppsV1().Deployments("mynamespace").Get(ctx, "mydeployment", metav1.GetOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, "myapp:2", deployment.Spec.Template.Spec.Containers[0].Image)
+		assert.Equal(t, labels, deployment.Spec.Template.Labels)
+	})
+
+	t.Run("ReturnsObjectErrorIfStatefulSetHasNoPreviousRevision", func(t *testing.T) {
+
+		e, _, clientset, _ := newTestNativeEngine(t)
+		_, err := clientset.AppsV1().StatefulSets("mynamespace").Create(context.Background(), &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "mystatefulset", Namespace: "mynamespace"},
+			Spec:       appsv1.StatefulSetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "myapp"}}},
+		}, metav1.CreateOptions{})
+		assert.Nil(t, err)
+
+		// act
+		_, err = e.RolloutUndo(context.Background(), "statefulset", "mystatefulset")
+
+		assert.NotNil(t, err)
+		var objectErr *ObjectError
+		assert.True(t, errors.As(err, &objectErr))
+		assert.Equal(t, "rollback", objectErr.Operation)
+	})
+}
+
+func TestNativeEngineListObjects(t *testing.T) {
+
+	t.Run("ListsObjectsOfAllNamespacedKindsMatchingLabelSelector", func(t *testing.T) {
+
+		managed := newTestConfigMap("managed", "a")
+		managed.SetLabels(map[string]string{"estafette.io/application": "myapp"})
+		owned := newTestConfigMap("owned", "c")
+		owned.SetLabels(map[string]string{"estafette.io/application": "myapp"})
+		owned.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "v1", Kind: "ConfigMap", Name: "managed", UID: "123"}})
+		e, _, clientset, _ := newTestNativeEngine(t, managed, owned, newTestConfigMap("unmanaged", "b"))
+		clientset.Fake.Resources = []*metav1.APIResourceList{{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: metav1.Verbs{"list", "delete"}},
+				{Name: "namespaces", Kind: "Namespace", Namespaced: false, Verbs: metav1.Verbs{"list", "delete"}},
+			},
+		}}
+
+		// act
+		objects, err := e.ListObjects(context.Background(), "estafette.io/application=myapp")
+
+		assert.Nil(t, err)
+		assert.ElementsMatch(t, []LiveObject{{Version: "v1", Kind: "ConfigMap", Name: "managed"}, {Version: "v1", Kind: "ConfigMap", Name: "owned", Owned: true}}, objects)
+	})
+}
+
+func TestNativeEngineDeleteObject(t *testing.T) {
+
+	t.Run("DeletesObject", func(t *testing.T) {
+
+		e, dynamicClient, _, out := newTestNativeEngine(t, newTestConfigMap("myconfig", "a"))
+
+		// act
+		err := e.DeleteObject(context.Background(), LiveObject{Version: "v1", Kind: "ConfigMap", Name: "myconfig"})
+
+		assert.Nil(t, err)
+		_, err = dynamicClient.Resource(schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}).Namespace("mynamespace").Get(context.Background(), "myconfig", metav1.GetOptions{})
+		assert.NotNil(t, err)
+		assert.Equal(t, "configmap/myconfig deleted\n", out.String())
+	})
+}
+
+func TestNativeEngineGetDeploymentReplicas(t *testing.T) {
+
+	t.Run("ReturnsNotExistsIfDeploymentIsNotFound", func(t *testing.T) {
+
+		e, _, _, _ := newTestNativeEngine(t)
+
+		// act
+		_, exists, err := e.GetDeploymentReplicas(context.Background(), "mydeployment")
+
+		assert.Nil(t, err)
+		assert.False(t, exists)
+	})
+}
+
+func TestNativeEngineJobSucceeded(t *testing.T) {
+
+	t.Run("ReturnsTrueIfJobHasSucceededPods", func(t *testing.T) {
+
+		e, _, clientset, _ := newTestNativeEngine(t)
+		_, err := clientset.BatchV1().Jobs("mynamespace").Create(context.Background(), &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "myjob", Namespace: "mynamespace"},
+			Status:     batchv1.JobStatus{Succeeded: 1},
+		}, metav1.CreateOptions{})
+		assert.Nil(t, err)
+
+		// act
+		succeeded, err := e.JobSucceeded(context.Background(), "myjob")
+
+		assert.Nil(t, err)
+		assert.True(t, succeeded)
+	})
+}
+
+func TestReadObjects(t *testing.T) {
+
+	t.Run("SkipsEmptyDocumentsAndFlattensLists", func(t *testing.T) {
+
+		manifestPath := writeTestManifest(t, "---\n# comment only\n---\napiVersion: v1\nkind: List\nitems:\n- apiVersion: v1\n  kind: ConfigMap\n  metadata:\n    name: a\n- apiVersion: v1\n  kind: ConfigMap\n  metadata:\n    name: b\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: c\n  annotations:\n    replicas: \"3\"\n")
+
+		// act
+		objects, err := readObjects(manifestPath)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 3, len(objects))
+		assert.Equal(t, "a", objects[0].GetName())
+		assert.Equal(t, "b", objects[1].GetName())
+		assert.Equal(t, "c", objects[2].GetName())
+	})
+}
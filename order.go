@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// kindOrder lists the groups of kinds in the order they're applied; kinds of built-in api groups that aren't listed go into other and all remaining kinds into customresources
+var kindOrder = []struct {
+	name  string
+	kinds []string
+}{
+	{name: "namespaces", kinds: []string{"Namespace"}},
+	{name: "customresourcedefinitions", kinds: []string{"CustomResourceDefinition"}},
+	{name: "rbac", kinds: []string{"ServiceAccount", "Role", "ClusterRole", "RoleBinding", "ClusterRoleBinding"}},
+	{name: "config", kinds: []string{"ConfigMap", "Secret", "PersistentVolume", "PersistentVolumeClaim", "StorageClass", "ResourceQuota", "LimitRange", "PriorityClass"}},
+	{name: "services", kinds: []string{"Service"}},
+	{name: "workloads", kinds: []string{"Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "Pod", "Job", "CronJob"}},
+	{name: "other"},
+	{name: "customresources"},
+}
+
+// prerequisiteGroups is the number of groups at the start of kindOrder that have to exist in the cluster before the other objects can be dry-run
+const prerequisiteGroups = 2
+
+// OrderObjects sorts the objects into the groups of kindOrder, keeping the order of the manifests within a group
+func OrderObjects(objects []*unstructured.Unstructured) [][]*unstructured.Unstructured {
+	groups := make([][]*unstructured.Unstructured, len(kindOrder))
+	for _, obj := range objects {
+		i := kindGroup(obj)
+		groups[i] = append(groups[i], obj)
+	}
+	return groups
+}
+
+func kindGroup(obj *unstructured.Unstructured) int {
+	for i, group := range kindOrder {
+		for _, kind := range group.kinds {
+			if obj.GetKind() == kind {
+				return i
+			}
+		}
+	}
+
+	if isBuiltinGroup(obj.GroupVersionKind().Group) {
+		return len(kindOrder) - 2
+	}
+	return len(kindOrder) - 1
+}
+
+func isBuiltinGroup(group string) bool {
+	switch group {
+	case "", "apps", "batch", "autoscaling", "policy", "extensions":
+		return true
+	}
+	return strings.HasSuffix(group, ".k8s.io")
+}
+
+// objectsYAML returns the objects as multi-document yaml
+func objectsYAML(objects []*unstructured.Unstructured) (string, error) {
+	documents := []string{}
+	for _, obj := range objects {
+		document, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return "", fmt.Errorf("Failed marshalling %v %v: %w", obj.GetKind(), obj.GetName(), err)
+		}
+		documents = append(documents, string(document))
+	}
+	return strings.Join(documents, "---\n"), nil
+}
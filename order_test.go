@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestOrderObjects(t *testing.T) {
+
+	t.Run("SortsObjectsByGroupOfKindsKeepingOrderWithinGroup", func(t *testing.T) {
+
+		newObject := func(apiVersion, kind, name string) *unstructured.Unstructured {
+			obj := &unstructured.Unstructured{}
+			obj.SetAPIVersion(apiVersion)
+			obj.SetKind(kind)
+			obj.SetName(name)
+			return obj
+		}
+		objects := []*unstructured.Unstructured{
+			newObject("cert-manager.io/v1", "Certificate", "mycertificate"),
+			newObject("networking.k8s.io/v1", "Ingress", "myingress"),
+			newObject("apps/v1", "Deployment", "b"),
+			newObject("v1", "Secret", "mysecret"),
+			newObject("apps/v1", "Deployment", "a"),
+			newObject("rbac.authorization.k8s.io/v1", "RoleBinding", "myrolebinding"),
+			newObject("v1", "Namespace", "mynamespace"),
+		}
+
+		// act
+		groups := OrderObjects(objects)
+
+		names := [][]string{}
+		for _, group := range groups {
+			groupNames := []string{}
+			for _, obj := range group {
+				groupNames = append(groupNames, obj.GetName())
+			}
+			names = append(names, groupNames)
+		}
+		assert.Equal(t, [][]string{{"mynamespace"}, {}, {"myrolebinding"}, {"mysecret"}, {}, {"b", "a"}, {"myingress"}, {"mycertificate"}}, names)
+	})
+}
@@ -1,8 +1,27 @@
 package main
 
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
 // Params is used to parameterize the deployment, set from custom properties in the manifest
 type Params struct {
-	Manifests []string `json:"manifests,omitempty" yaml:"manifests,omitempty"`
+	Manifests        []string `json:"manifests,omitempty" yaml:"manifests,omitempty"`
+	ExcludeManifests []string `json:"excludeManifests,omitempty" yaml:"excludeManifests,omitempty" merge:"append"`
+
+	Kustomize             string `json:"kustomize,omitempty" yaml:"kustomize,omitempty"`
+	KustomizePlaceholders string `json:"kustomizePlaceholders,omitempty" yaml:"kustomizePlaceholders,omitempty"`
+
+	Chart            string   `json:"chart,omitempty" yaml:"chart,omitempty"`
+	ChartValues      []string `json:"chartValues,omitempty" yaml:"chartValues,omitempty" merge:"append"`
+	ChartReleaseName string   `json:"chartReleaseName,omitempty" yaml:"chartReleaseName,omitempty"`
 
 	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
 
@@ -11,18 +30,293 @@ type Params struct {
 	Daemonsets   []string `json:"daemonsets,omitempty" yaml:"daemonsets,omitempty"`
 	Jobs         []string `json:"jobs,omitempty" yaml:"jobs,omitempty"`
 
-	Placeholders map[string]string `json:"placeholders,omitempty" yaml:"placeholders,omitempty"`
+	Placeholders        map[string]string            `json:"placeholders,omitempty" yaml:"placeholders,omitempty"`
+	ClusterPlaceholders map[string]map[string]string `json:"clusterPlaceholders,omitempty" yaml:"clusterPlaceholders,omitempty"`
+	Renderer            string                       `json:"renderer,omitempty" yaml:"renderer,omitempty"`
+
+	StrictPlaceholders   bool     `json:"strictPlaceholders,omitempty" yaml:"strictPlaceholders,omitempty"`
+	PlaceholderAllowlist []string `json:"placeholderAllowlist,omitempty" yaml:"placeholderAllowlist,omitempty" merge:"append"`
+
+	EnvironmentPlaceholders []string `json:"environmentPlaceholders,omitempty" yaml:"environmentPlaceholders,omitempty" merge:"append"`
+	SensitivePlaceholders   []string `json:"sensitivePlaceholders,omitempty" yaml:"sensitivePlaceholders,omitempty" merge:"append"`
+
+	PlaceholderFiles []string                   `json:"placeholderFiles,omitempty" yaml:"placeholderFiles,omitempty" merge:"append"`
+	FilePlaceholders map[string]FilePlaceholder `json:"filePlaceholders,omitempty" yaml:"filePlaceholders,omitempty"`
 
 	AwaitZeroReplicas bool `json:"awaitZeroReplicas,omitempty" yaml:"awaitZeroReplicas,omitempty"`
 
 	DryRun bool `json:"dryrun,omitempty" yaml:"dryrun,omitempty"`
 
 	JobTimeoutSeconds int `json:"jobtimeoutseconds,omitempty" yaml:"jobtimeoutseconds,omitempty"`
+
+	RolloutTimeoutSeconds  int  `json:"rolloutTimeoutSeconds,omitempty" yaml:"rolloutTimeoutSeconds,omitempty"`
+	WorkloadTimeoutSeconds int  `json:"workloadTimeoutSeconds,omitempty" yaml:"workloadTimeoutSeconds,omitempty"`
+	AutoRollback           bool `json:"autoRollback,omitempty" yaml:"autoRollback,omitempty"`
+
+	Engine string `json:"engine,omitempty" yaml:"engine,omitempty"`
+
+	ServerSideApply bool `json:"serverSideApply,omitempty" yaml:"serverSideApply,omitempty"`
+	ForceConflicts  bool `json:"forceConflicts,omitempty" yaml:"forceConflicts,omitempty"`
+
+	Application         string   `json:"application,omitempty" yaml:"application,omitempty"`
+	Prune               bool     `json:"prune,omitempty" yaml:"prune,omitempty"`
+	PruneProtectedKinds []string `json:"pruneProtectedKinds,omitempty" yaml:"pruneProtectedKinds,omitempty"`
 }
 
 // SetDefaults fills in empty fields with convention-based defaults
 func (p *Params) SetDefaults() {
-	if len(p.Manifests) == 0 {
+	if len(p.Manifests) == 0 && p.Kustomize == "" && p.Chart == "" {
 		p.Manifests = []string{"kubernetes.yaml"}
 	}
+	if p.Kustomize != "" && p.KustomizePlaceholders == "" {
+		p.KustomizePlaceholders = "after"
+	}
+	if p.Chart != "" && p.ChartReleaseName == "" {
+		p.ChartReleaseName = chartName(p.Chart)
+	}
+	if p.Renderer == "" {
+		p.Renderer = "placeholders"
+	}
+	if p.Prune && len(p.PruneProtectedKinds) == 0 {
+		p.PruneProtectedKinds = []string{"Namespace", "PersistentVolumeClaim"}
+	}
+	if p.Engine == "" {
+		p.Engine = "kubectl"
+	}
+}
+
+// validateValues checks the values of the params that are set, so it applies to the defaults of a credential as well as to the params of a release
+func (p *Params) validateValues() []error {
+
+	errs := []error{}
+
+	switch p.Engine {
+	case "", "kubectl", "native":
+	default:
+		errs = append(errs, fmt.Errorf("Engine %v is not supported; use kubectl or native", p.Engine))
+	}
+	switch p.Renderer {
+	case "", "placeholders", "gotemplate":
+	default:
+		errs = append(errs, fmt.Errorf("Renderer %v is not supported; use placeholders or gotemplate", p.Renderer))
+	}
+	switch p.KustomizePlaceholders {
+	case "", "before", "after":
+	default:
+		errs = append(errs, fmt.Errorf("KustomizePlaceholders %v is not supported; use before or after", p.KustomizePlaceholders))
+	}
+	if p.RolloutTimeoutSeconds < 0 {
+		errs = append(errs, fmt.Errorf("RolloutTimeoutSeconds %v can't be negative", p.RolloutTimeoutSeconds))
+	}
+	if p.WorkloadTimeoutSeconds < 0 {
+		errs = append(errs, fmt.Errorf("WorkloadTimeoutSeconds %v can't be negative", p.WorkloadTimeoutSeconds))
+	}
+
+	return errs
+}
+
+// Validate checks the params of a release after the defaults are set, and returns all problems at once
+func (p *Params) Validate() error {
+
+	errs := p.validateValues()
+
+	if len(p.Manifests) == 0 && p.Kustomize == "" && p.Chart == "" {
+		errs = append(errs, fmt.Errorf("Manifests, kustomize or chart is required"))
+	}
+	for _, m := range p.Manifests {
+		if strings.TrimSpace(m) == "" {
+			errs = append(errs, fmt.Errorf("Manifests can't contain an empty entry"))
+		}
+	}
+	if p.Namespace != "" {
+		for _, msg := range validation.IsDNS1123Label(p.Namespace) {
+			errs = append(errs, fmt.Errorf("Namespace %v is invalid: %v", p.Namespace, msg))
+		}
+	}
+	workloads := []struct {
+		kind  string
+		names []string
+	}{{"Deployments", p.Deployments}, {"Statefulsets", p.Statefulsets}, {"Daemonsets", p.Daemonsets}, {"Jobs", p.Jobs}}
+	for _, w := range workloads {
+		for _, name := range w.names {
+			for _, msg := range validation.IsDNS1123Subdomain(name) {
+				errs = append(errs, fmt.Errorf("%v entry %v is invalid: %v", w.kind, name, msg))
+			}
+		}
+	}
+	if p.JobTimeoutSeconds < 0 {
+		errs = append(errs, fmt.Errorf("Jobtimeoutseconds %v can't be negative", p.JobTimeoutSeconds))
+	}
+	// the application defaults to the repository name, which stages releasing different parts of a repository to the same namespace share, so they would prune each other's objects
+	if p.Prune && p.Application == "" {
+		errs = append(errs, fmt.Errorf("Application is required when prune is set"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// UnmarshalParamsStrict unmarshals the custom properties of the stage into params and returns the keys set in the stage; it fails on keys that are neither params nor credentials params, also in nested params like filePlaceholders, suggesting the key that was probably meant
+func UnmarshalParamsStrict(paramsYAML string, params *Params) (keys []string, err error) {
+
+	var properties map[string]interface{}
+	err = yaml.Unmarshal([]byte(paramsYAML), &properties)
+	if err != nil {
+		return nil, fmt.Errorf("Failed unmarshalling parameters: %w", err)
+	}
+
+	known := append(fieldTags(reflect.TypeOf(Params{}), "yaml"), fieldTags(reflect.TypeOf(CredentialsParam{}), "json")...)
+
+	errs := unknownKeyErrors("", properties, reflect.TypeOf(Params{}), known)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	err = yaml.Unmarshal([]byte(paramsYAML), params)
+	if err != nil {
+		return nil, fmt.Errorf("Failed unmarshalling parameters: %w", err)
+	}
+
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// unknownKeyErrors returns an error for every key in value that isn't one of the known keys of struct type t, walking into the structs in nested maps and lists;
+// nested keys are named by their path, like filePlaceholders.CA_CERT.file
+func unknownKeyErrors(path string, value interface{}, t reflect.Type, known []string) []error {
+
+	errs := []error{}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return unknownKeyErrors(path, value, t.Elem(), nil)
+
+	case reflect.Struct:
+		if known == nil {
+			known = fieldTags(t, "yaml")
+		}
+		properties := stringKeyedMap(value)
+		for _, key := range sortedKeys(properties) {
+			keyPath := strings.TrimPrefix(path+"."+key, ".")
+			if !containsString(known, key) {
+				if suggestion := closestKey(key, known); suggestion != "" {
+					errs = append(errs, fmt.Errorf("Parameter %v is unknown; did you mean %v?", keyPath, suggestion))
+				} else {
+					errs = append(errs, fmt.Errorf("Parameter %v is unknown", keyPath))
+				}
+				continue
+			}
+			if field, ok := fieldByTag(t, "yaml", key); ok {
+				errs = append(errs, unknownKeyErrors(keyPath, properties[key], field.Type, nil)...)
+			}
+		}
+
+	case reflect.Map:
+		properties := stringKeyedMap(value)
+		for _, key := range sortedKeys(properties) {
+			errs = append(errs, unknownKeyErrors(path+"."+key, properties[key], t.Elem(), nil)...)
+		}
+
+	case reflect.Slice:
+		if items, ok := value.([]interface{}); ok {
+			for i, item := range items {
+				errs = append(errs, unknownKeyErrors(fmt.Sprintf("%v[%v]", path, i), item, t.Elem(), nil)...)
+			}
+		}
+	}
+
+	return errs
+}
+
+// stringKeyedMap returns the yaml mapping in value with its keys as strings, or nil if value isn't a mapping; values of the wrong type are reported when unmarshalling
+func stringKeyedMap(value interface{}) map[string]interface{} {
+	switch m := value.(type) {
+	case map[string]interface{}:
+		return m
+	case map[interface{}]interface{}:
+		properties := map[string]interface{}{}
+		for k, v := range m {
+			properties[fmt.Sprint(k)] = v
+		}
+		return properties
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// fieldByTag returns the field of struct type t with the name in the tag with the key
+func fieldByTag(t reflect.Type, key, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if strings.Split(t.Field(i).Tag.Get(key), ",")[0] == name {
+			return t.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// fieldTags returns the names of the fields of struct type t in the tag with the key
+func fieldTags(t reflect.Type, key string) []string {
+	tags := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get(key), ",")[0]
+		if name != "" && name != "-" {
+			tags = append(tags, name)
+		}
+	}
+	return tags
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// closestKey returns the known key with the smallest edit distance to key, ignoring case, or an empty string if none of them is close
+func closestKey(key string, known []string) string {
+	closest := ""
+	closestDistance := 3
+	for _, k := range known {
+		distance := editDistance(strings.ToLower(key), strings.ToLower(k))
+		if distance < closestDistance {
+			closest = k
+			closestDistance = distance
+		}
+	}
+	return closest
+}
+
+// editDistance returns the levenshtein distance between a and b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParamsValidate(t *testing.T) {
+
+	t.Run("ReturnsNilIfParamsAreValid", func(t *testing.T) {
+
+		params := Params{Manifests: []string{"kubernetes.yaml"}, Namespace: "mynamespace", Deployments: []string{"mydeployment"}, JobTimeoutSeconds: 300}
+
+		// act
+		err := params.Validate()
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("ReturnsAllProblemsAtOnce", func(t *testing.T) {
+
+		params := Params{Namespace: "My_Namespace", Daemonsets: []string{"my daemonset"}, JobTimeoutSeconds: -1}
+
+		// act
+		err := params.Validate()
+
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "Manifests, kustomize or chart is required")
+		assert.Contains(t, err.Error(), "Namespace My_Namespace is invalid")
+		assert.Contains(t, err.Error(), "Daemonsets entry my daemonset is invalid")
+		assert.Contains(t, err.Error(), "Jobtimeoutseconds -1 can't be negative")
+	})
+
+	t.Run("ReturnsErrorIfPruneIsSetWithoutApplication", func(t *testing.T) {
+
+		params := Params{Manifests: []string{"kubernetes.yaml"}, Prune: true}
+
+		// act
+		err := params.Validate()
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "Application is required when prune is set", err.Error())
+	})
+
+	t.Run("ReturnsNilIfOnlyKustomizeIsSet", func(t *testing.T) {
+
+		params := Params{Kustomize: "k8s/overlays/production"}
+
+		// act
+		err := params.Validate()
+
+		assert.Nil(t, err)
+	})
+}
+
+func TestUnmarshalParamsStrict(t *testing.T) {
+
+	t.Run("UnmarshalsParamsAndAllowsCredentialsParams", func(t *testing.T) {
+
+		var params Params
+
+		// act
+		keys, err := UnmarshalParamsStrict("credentials:\n- gke-production\nparallelClusters: true\nnamespace: mynamespace\ndaemonsets:\n- mydaemonset\n", &params)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"credentials", "daemonsets", "namespace", "parallelClusters"}, keys)
+		assert.Equal(t, "mynamespace", params.Namespace)
+		assert.Equal(t, []string{"mydaemonset"}, params.Daemonsets)
+	})
+
+	t.Run("ReturnsErrorWithSuggestionsForUnknownKeys", func(t *testing.T) {
+
+		var params Params
+
+		// act
+		_, err := UnmarshalParamsStrict("deamonsets:\n- mydaemonset\ndryRun: true\ncolour: blue\n", &params)
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "Parameter colour is unknown\nParameter deamonsets is unknown; did you mean daemonsets?\nParameter dryRun is unknown; did you mean dryrun?", err.Error())
+		assert.Nil(t, params.Daemonsets)
+	})
+
+	t.Run("ReturnsErrorWithSuggestionsForUnknownNestedKeys", func(t *testing.T) {
+
+		var params Params
+
+		// act
+		_, err := UnmarshalParamsStrict("filePlaceholders:\n  CA_CERT:\n    fiel: certs/ca.pem\n    base64: true\n  NGINX_CONF:\n    file: nginx.conf\n    indnet: 4\n", &params)
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "Parameter filePlaceholders.CA_CERT.fiel is unknown; did you mean file?\nParameter filePlaceholders.NGINX_CONF.indnet is unknown; did you mean indent?", err.Error())
+		assert.Nil(t, params.FilePlaceholders)
+	})
+}
+
+func TestEditDistance(t *testing.T) {
+
+	t.Run("ReturnsNumberOfEditsBetweenStrings", func(t *testing.T) {
+
+		assert.Equal(t, 0, editDistance("daemonsets", "daemonsets"))
+		assert.Equal(t, 2, editDistance("deamonsets", "daemonsets"))
+		assert.Equal(t, 3, editDistance("kitten", "sitting"))
+		assert.Equal(t, 4, editDistance("", "jobs"))
+	})
+}
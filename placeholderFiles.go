@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// FilePlaceholder is a placeholder with the content of a single file as value
+type FilePlaceholder struct {
+	File string `json:"file,omitempty" yaml:"file,omitempty"`
+	// Base64 encodes the content, for the data of a Secret
+	Base64 bool `json:"base64,omitempty" yaml:"base64,omitempty"`
+	// Indent prefixes all lines but the first with spaces, for a block scalar in a ConfigMap
+	Indent int `json:"indent,omitempty" yaml:"indent,omitempty"`
+}
+
+// LoadPlaceholderFiles returns the placeholders from the key-value files, in order so later files override earlier ones, and from the single files, together with the file each placeholder came from; it reports the problems with all files at once
+func LoadPlaceholderFiles(placeholderFiles []string, filePlaceholders map[string]FilePlaceholder) (placeholders, files map[string]string, err error) {
+
+	placeholders = map[string]string{}
+	files = map[string]string{}
+	errs := []error{}
+
+	for _, f := range placeholderFiles {
+		values, err := readPlaceholderFile(f)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for k, v := range values {
+			placeholders[k] = v
+			files[k] = f
+		}
+	}
+
+	// sort the names so the errors are in the same order for every release
+	names := make([]string, 0, len(filePlaceholders))
+	for name := range filePlaceholders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, err := readFilePlaceholder(filePlaceholders[name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Placeholder %v: %w", name, err))
+			continue
+		}
+		placeholders[name] = value
+		files[name] = filePlaceholders[name].File
+	}
+
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+
+	return placeholders, files, nil
+}
+
+// readPlaceholderFile reads the key-values in a yaml, json or .env file
+func readPlaceholderFile(file string) (map[string]string, error) {
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("Failed reading placeholder file %v: %w", file, err)
+	}
+
+	switch ext := filepath.Ext(file); {
+	case ext == ".yaml" || ext == ".yml" || ext == ".json":
+		return parseYAMLPlaceholders(file, content)
+	case ext == ".env" || filepath.Base(file) == ".env":
+		return parseEnvPlaceholders(file, content)
+	}
+
+	return nil, fmt.Errorf("Placeholder file %v is not a .yaml, .yml, .json or .env file", file)
+}
+
+func parseYAMLPlaceholders(file string, content []byte) (map[string]string, error) {
+
+	var values map[string]interface{}
+	err := yaml.Unmarshal(content, &values)
+	if err != nil {
+		return nil, fmt.Errorf("Failed parsing placeholder file %v: %w", file, err)
+	}
+	for k, v := range values {
+		switch v.(type) {
+		case map[interface{}]interface{}, []interface{}:
+			return nil, fmt.Errorf("Placeholder file %v has a structured value for key %v; only strings, numbers and booleans are supported", file, k)
+		}
+	}
+
+	// decode the scalars as strings as well, so they keep the text they're written with instead of yaml 1.1 turning 1.10 into 1.1, yes into true or 0123 into 83
+	placeholders := map[string]string{}
+	err = yaml.Unmarshal(content, &placeholders)
+	if err != nil {
+		return nil, fmt.Errorf("Failed parsing placeholder file %v: %w", file, err)
+	}
+
+	return placeholders, nil
+}
+
+func parseEnvPlaceholders(file string, content []byte) (map[string]string, error) {
+
+	placeholders := map[string]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		keyValue := strings.SplitN(strings.TrimPrefix(line, "export "), "=", 2)
+		if len(keyValue) != 2 || strings.TrimSpace(keyValue[0]) == "" {
+			return nil, fmt.Errorf("Failed parsing placeholder file %v: line %v is not KEY=VALUE", file, lineNumber)
+		}
+
+		value := strings.TrimSpace(keyValue[1])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		placeholders[strings.TrimSpace(keyValue[0])] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Failed reading placeholder file %v: %w", file, err)
+	}
+
+	return placeholders, nil
+}
+
+// readFilePlaceholder returns the content of the file, base64 encoded or indented if requested
+func readFilePlaceholder(p FilePlaceholder) (string, error) {
+
+	if p.File == "" {
+		return "", fmt.Errorf("File is required")
+	}
+	if p.Base64 && p.Indent > 0 {
+		return "", fmt.Errorf("Base64 and indent can't be used together")
+	}
+	if p.Indent < 0 {
+		return "", fmt.Errorf("Indent %v can't be negative", p.Indent)
+	}
+
+	content, err := os.ReadFile(p.File)
+	if err != nil {
+		return "", fmt.Errorf("Failed reading file: %w", err)
+	}
+
+	if p.Base64 {
+		return base64.StdEncoding.EncodeToString(content), nil
+	}
+
+	value := strings.TrimSuffix(string(content), "\n")
+	if p.Indent > 0 {
+		value = strings.ReplaceAll(value, "\n", "\n"+strings.Repeat(" ", p.Indent))
+	}
+
+	return value, nil
+}
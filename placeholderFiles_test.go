@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadPlaceholderFiles(t *testing.T) {
+
+	writeFile := func(t *testing.T, dir, name, content string) string {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, os.WriteFile(path, []byte(content), 0666))
+		return path
+	}
+
+	t.Run("ReadsKeyValuesFromYAMLJSONAndEnvFilesInOrder", func(t *testing.T) {
+
+		dir := t.TempDir()
+		yamlFile := writeFile(t, dir, "values.yaml", "REGION: europe-west1\nREPLICAS: 3\nDEBUG: false\n")
+		jsonFile := writeFile(t, dir, "values.json", `{"REPLICAS": 5, "TIER": "backend"}`)
+		envFile := writeFile(t, dir, "production.env", "# production\nexport DB_HOST=db.example.com\nGREETING=\"hello world\"\n\n")
+
+		// act
+		placeholders, files, err := LoadPlaceholderFiles([]string{yamlFile, jsonFile, envFile}, nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{
+			"REGION":   "europe-west1",
+			"REPLICAS": "5",
+			"DEBUG":    "false",
+			"TIER":     "backend",
+			"DB_HOST":  "db.example.com",
+			"GREETING": "hello world",
+		}, placeholders)
+		assert.Equal(t, jsonFile, files["REPLICAS"])
+		assert.Equal(t, envFile, files["DB_HOST"])
+	})
+
+	t.Run("KeepsYAMLScalarsAsWritten", func(t *testing.T) {
+
+		dir := t.TempDir()
+		yamlFile := writeFile(t, dir, "values.yaml", "VERSION: 1.10\nENABLED: yes\nID: 0123\nEMPTY:\n")
+
+		// act
+		placeholders, _, err := LoadPlaceholderFiles([]string{yamlFile}, nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{
+			"VERSION": "1.10",
+			"ENABLED": "yes",
+			"ID":      "0123",
+			"EMPTY":   "",
+		}, placeholders)
+	})
+
+	t.Run("ReadsSingleFilesBase64EncodedOrIndented", func(t *testing.T) {
+
+		dir := t.TempDir()
+		certificate := writeFile(t, dir, "tls.crt", "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n")
+
+		// act
+		placeholders, _, err := LoadPlaceholderFiles(nil, map[string]FilePlaceholder{
+			"TLS_CRT":        {File: certificate, Base64: true},
+			"TLS_CRT_INLINE": {File: certificate, Indent: 4},
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "LS0tLS1CRUdJTiBDRVJUSUZJQ0FURS0tLS0tCk1JSUIKLS0tLS1FTkQgQ0VSVElGSUNBVEUtLS0tLQo=", placeholders["TLS_CRT"])
+		assert.Equal(t, "-----BEGIN CERTIFICATE-----\n    MIIB\n    -----END CERTIFICATE-----", placeholders["TLS_CRT_INLINE"])
+	})
+
+	t.Run("ReturnsAllProblemsAtOnce", func(t *testing.T) {
+
+		dir := t.TempDir()
+		invalidYAML := writeFile(t, dir, "invalid.yaml", "REGION: [europe-west1\n")
+		structuredYAML := writeFile(t, dir, "structured.yaml", "REGIONS:\n- europe-west1\n")
+		invalidEnv := writeFile(t, dir, "invalid.env", "REGION\n")
+		text := writeFile(t, dir, "values.txt", "REGION=europe-west1\n")
+
+		// act
+		_, _, err := LoadPlaceholderFiles([]string{invalidYAML, structuredYAML, invalidEnv, filepath.Join(dir, "missing.yaml"), text}, map[string]FilePlaceholder{
+			"TLS_CRT": {File: filepath.Join(dir, "missing.crt")},
+		})
+
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "Failed parsing placeholder file "+invalidYAML)
+		assert.Contains(t, err.Error(), "structured value for key REGIONS")
+		assert.Contains(t, err.Error(), "line 1 is not KEY=VALUE")
+		assert.Contains(t, err.Error(), "Failed reading placeholder file "+filepath.Join(dir, "missing.yaml"))
+		assert.Contains(t, err.Error(), "Placeholder file "+text+" is not a .yaml, .yml, .json or .env file")
+		assert.Contains(t, err.Error(), "Placeholder TLS_CRT: Failed reading file")
+	})
+}
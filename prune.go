@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	managedByLabel   = "app.kubernetes.io/managed-by=estafette-extension-gke-yaml"
+	applicationLabel = "estafette.io/application"
+)
+
+// derivedKinds are kinds the cluster creates for other objects, copying their labels without setting an owner, like the endpoints of a service
+var derivedKinds = []string{"Endpoints", "EndpointSlice"}
+
+// application returns the name of the application that owns the released objects, which defaults to the name of the git repository
+func (d *Deployer) application() string {
+	if d.params.Application != "" {
+		return d.params.Application
+	}
+	for _, e := range d.environ {
+		if strings.HasPrefix(e, "ESTAFETTE_GIT_NAME=") {
+			return strings.TrimPrefix(e, "ESTAFETTE_GIT_NAME=")
+		}
+	}
+	return ""
+}
+
+// findPrunable returns the live objects labeled as managed by this extension for the application that are no longer in the rendered manifests, except for protected kinds and objects managed by the cluster or another object
+func (d *Deployer) findPrunable(ctx context.Context) ([]LiveObject, error) {
+
+	application := d.params.Application
+	if application == "" {
+		return nil, fmt.Errorf("Pruning requires the application parameter to be set")
+	}
+
+	rendered := map[string]bool{}
+	for _, m := range d.renderedManifests {
+		objects, err := readObjects(d.renderedPath(m))
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objects {
+			if obj.GetNamespace() != "" && d.params.Namespace != "" && obj.GetNamespace() != d.params.Namespace {
+				continue
+			}
+			rendered[LiveObject{Group: obj.GroupVersionKind().Group, Kind: obj.GetKind(), Name: obj.GetName()}.String()] = true
+		}
+	}
+
+	live, err := d.engine.ListObjects(ctx, fmt.Sprintf("%v,%v=%v", managedByLabel, applicationLabel, application))
+	if err != nil {
+		return nil, fmt.Errorf("Failed listing objects to prune: %w", err)
+	}
+
+	prunable := []LiveObject{}
+	for _, obj := range live {
+		if rendered[obj.String()] || d.isProtectedKind(obj.Kind) || obj.Owned || containsString(derivedKinds, obj.Kind) {
+			continue
+		}
+		prunable = append(prunable, obj)
+	}
+
+	return prunable, nil
+}
+
+func (d *Deployer) isProtectedKind(kind string) bool {
+	for _, k := range d.params.PruneProtectedKinds {
+		if strings.EqualFold(k, kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// prune deletes the objects that are no longer in the rendered manifests
+func (d *Deployer) prune(ctx context.Context, prunable []LiveObject) error {
+	for _, obj := range prunable {
+		log.Info().Msgf("Pruning %v...", obj)
+		err := d.engine.DeleteObject(ctx, obj)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// redactedValue replaces sensitive values in output
+const redactedValue = "***"
+
+// minRedactedLength is the length below which values aren't redacted, since masking every occurrence of a few characters would make the output unreadable
+const minRedactedLength = 4
+
+// Redactor masks sensitive values, and their base64 encoding as shown in the data of Secrets, in logs and command output
+type Redactor struct {
+	mu     sync.RWMutex
+	values []string
+}
+
+// NewRedactor returns a Redactor without sensitive values
+func NewRedactor() *Redactor {
+	return &Redactor{}
+}
+
+// AddValue marks a value as sensitive
+func (r *Redactor) AddValue(value string) {
+	if len(value) < minRedactedLength {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.values = append(r.values, value, base64.StdEncoding.EncodeToString([]byte(value)))
+
+	// replace the longest values first, so a value containing another one is masked completely
+	sort.Slice(r.values, func(i, j int) bool { return len(r.values[i]) > len(r.values[j]) })
+}
+
+// Redact returns s with all sensitive values masked
+func (r *Redactor) Redact(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, v := range r.values {
+		s = strings.ReplaceAll(s, v, redactedValue)
+	}
+	return s
+}
+
+// Writer returns a writer that masks the sensitive values in everything written to w
+func (r *Redactor) Writer(w io.Writer) io.Writer {
+	return &redactingWriter{redactor: r, w: w}
+}
+
+type redactingWriter struct {
+	redactor *Redactor
+	w        io.Writer
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	_, err := io.WriteString(w.w, w.redactor.Redact(string(p)))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// secretDataFields are the fields of a Secret holding its values
+var secretDataFields = []string{"data", "stringData"}
+
+// RedactSecrets returns the manifest with the values of the data and stringData of all Secrets masked, keeping the keys; documents that aren't Secrets are returned as is
+func RedactSecrets(manifest string) string {
+
+	documents := []string{}
+	reader := yamlutil.NewYAMLReader(bufio.NewReader(strings.NewReader(manifest)))
+	for {
+		document, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// don't risk logging secrets from a manifest that can't be split
+			return redactedValue
+		}
+		documents = append(documents, redactSecretDocument(string(document)))
+	}
+
+	return strings.Join(documents, "---\n")
+}
+
+func redactSecretDocument(document string) string {
+
+	var obj map[string]interface{}
+	err := yaml.Unmarshal([]byte(document), &obj)
+	if err != nil {
+		if strings.Contains(document, "kind: Secret") {
+			return "# Secret that can't be parsed " + redactedValue + "\n"
+		}
+		return document
+	}
+	if obj["kind"] != "Secret" {
+		return document
+	}
+
+	for _, field := range secretDataFields {
+		if values, ok := obj[field].(map[string]interface{}); ok {
+			for k := range values {
+				values[k] = redactedValue
+			}
+		}
+	}
+
+	redacted, err := yaml.Marshal(obj)
+	if err != nil {
+		return "# Secret that can't be redacted " + redactedValue + "\n"
+	}
+
+	return string(redacted)
+}
+
+// RedactSecretObjects masks the values of the data and stringData of a live and a merged Secret before they're diffed, like kubectl diff does: values that are equal become ***, changed values *** (before) and *** (after), so added, removed and changed keys still show in the diff
+func RedactSecretObjects(live, merged *unstructured.Unstructured) {
+
+	for _, field := range secretDataFields {
+		liveValues := secretValues(live, field)
+		mergedValues := secretValues(merged, field)
+
+		for k, v := range liveValues {
+			if mv, ok := mergedValues[k]; ok && mv != v {
+				liveValues[k] = redactedValue + " (before)"
+				mergedValues[k] = redactedValue + " (after)"
+			} else {
+				liveValues[k] = redactedValue
+			}
+		}
+		for k, v := range mergedValues {
+			if v != redactedValue+" (after)" {
+				mergedValues[k] = redactedValue
+			}
+		}
+
+		if live != nil && liveValues != nil {
+			live.Object[field] = liveValues
+		}
+		if merged != nil && mergedValues != nil {
+			merged.Object[field] = mergedValues
+		}
+	}
+}
+
+func secretValues(obj *unstructured.Unstructured, field string) map[string]interface{} {
+	if obj == nil || obj.GetKind() != "Secret" {
+		return nil
+	}
+	values, ok := obj.Object[field].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return values
+}
+
+// kubectlDiffSecretRegex matches the header kubectl diff writes for the diff of a Secret, like diff -u -N /tmp/LIVE-1/v1.Secret.mynamespace.mysecret /tmp/MERGED-2/v1.Secret.mynamespace.mysecret
+var kubectlDiffSecretRegex = regexp.MustCompile(`^diff .*/v1\.Secret\.[^/ ]+$`)
+
+// yamlKeyRegex matches a yaml key with its indentation and the rest of the line
+var yamlKeyRegex = regexp.MustCompile(`^(\s*)("[^"]*"|'[^']*'|[^:#\s][^:]*):(\s.*)?$`)
+
+// RedactSecretDiff masks the values of the data and stringData of the Secrets in kubectl diff output: removed values become *** (before), added values *** (after) and unchanged values ***, so added, removed and changed keys still show;
+// when a hunk starts within the values of a Secret all indented lines up to the next top-level key are masked
+func RedactSecretDiff(diff string) string {
+
+	lines := strings.Split(diff, "\n")
+
+	inSecret := false
+	section := ""
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "diff "):
+			inSecret = kubectlDiffSecretRegex.MatchString(line)
+			section = ""
+			continue
+		case !inSecret || strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "+++ ") || line == "":
+			continue
+		case strings.HasPrefix(line, "@@"):
+			// the hunk can start in any section
+			section = "unknown"
+			continue
+		}
+
+		marker, content := line[:1], line[1:]
+		if content != "" && content[0] != ' ' {
+			// a top-level key
+			section = strings.SplitN(content, ":", 2)[0]
+			continue
+		}
+		if section != "data" && section != "stringData" && section != "unknown" {
+			continue
+		}
+
+		mask := redactedValue
+		switch marker {
+		case "-":
+			mask += " (before)"
+		case "+":
+			mask += " (after)"
+		}
+
+		if match := yamlKeyRegex.FindStringSubmatch(content); match != nil && len(match[1]) == 2 {
+			lines[i] = fmt.Sprintf("%v%v%v: %v", marker, match[1], match[2], mask)
+		} else {
+			// a line of a multi-line value
+			lines[i] = fmt.Sprintf("%v%v%v", marker, content[:len(content)-len(strings.TrimLeft(content, " "))], mask)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v2"
+)
+
+// Renderer turns the content of a manifest into the manifest that gets applied
+type Renderer interface {
+	Render(name string, content []byte) (string, error)
+}
+
+// NewRenderer returns the renderer selected with the renderer parameter
+func NewRenderer(params Params, environ []string) (Renderer, error) {
+	switch params.Renderer {
+	case "", "placeholders":
+		return &placeholderRenderer{
+			placeholders: withEnvironmentPlaceholders(params.Placeholders, environ, params.EnvironmentPlaceholders, params.SensitivePlaceholders),
+			strict:       params.StrictPlaceholders,
+			allowlist:    params.PlaceholderAllowlist,
+		}, nil
+	case "gotemplate":
+		return &goTemplateRenderer{
+			data: templateData{
+				Params:       params,
+				Placeholders: params.Placeholders,
+				Env:          estafetteEnvironment(environ),
+			},
+			strict:    params.StrictPlaceholders,
+			allowlist: params.PlaceholderAllowlist,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("Renderer %v is not supported; use placeholders or gotemplate", params.Renderer)
+}
+
+// placeholderRenderer replaces $NAME and ${NAME} with the value of placeholder NAME and leaves unknown placeholders untouched; in strict mode unknown placeholders that aren't allowlisted are returned as error
+type placeholderRenderer struct {
+	placeholders map[string]string
+	strict       bool
+	allowlist    []string
+}
+
+func (r *placeholderRenderer) Render(name string, content []byte) (string, error) {
+
+	unresolved := []UnresolvedPlaceholder{}
+
+	// expand line by line to be able to report where unresolved placeholders are
+	lines := strings.Split(string(content), "\n")
+	for i, line := range lines {
+		lines[i] = os.Expand(line, func(placeholderName string) string {
+
+			if placeholderValue, ok := r.placeholders[placeholderName]; ok {
+				return placeholderValue
+			}
+
+			if r.strict && !r.isAllowlisted(placeholderName) {
+				unresolved = append(unresolved, UnresolvedPlaceholder{File: name, Line: i + 1, Name: placeholderName})
+			}
+
+			return fmt.Sprintf("$%v", placeholderName)
+		})
+	}
+
+	if len(unresolved) > 0 {
+		return "", &UnresolvedPlaceholdersError{Placeholders: unresolved}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+func (r *placeholderRenderer) isAllowlisted(placeholderName string) bool {
+	return matchesAny(r.allowlist, placeholderName)
+}
+
+// withEnvironmentPlaceholders returns the placeholders with the environment variables matching one of the patterns added, without overriding placeholders that are set explicitly
+func withEnvironmentPlaceholders(placeholders map[string]string, environ []string, patterns, sensitive []string) map[string]string {
+	if len(patterns) == 0 {
+		return placeholders
+	}
+
+	merged := map[string]string{}
+	for _, e := range environ {
+		keyValue := strings.SplitN(e, "=", 2)
+		if len(keyValue) != 2 || !matchesAny(patterns, keyValue[0]) {
+			continue
+		}
+		if _, ok := placeholders[keyValue[0]]; ok {
+			continue
+		}
+		merged[keyValue[0]] = keyValue[1]
+		log.Info().Msgf("Using environment variable %v=%v as placeholder", keyValue[0], maskSecretLooking(keyValue[0], keyValue[1], sensitive))
+	}
+	for k, v := range placeholders {
+		merged[k] = v
+	}
+
+	return merged
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// secretLookingNameParts are the segments of names of variables whose values aren't logged
+var secretLookingNameParts = []string{"SECRET", "TOKEN", "PASSWORD", "PASSWD", "KEY", "CREDENTIAL", "PRIVATE", "AUTH"}
+
+// maskSecretLooking returns the value, or asterisks if the name matches one of the sensitive patterns or one of its segments separated by _, - or . looks like it holds a secret
+func maskSecretLooking(name, value string, sensitive []string) string {
+	if matchesAny(sensitive, name) {
+		return redactedValue
+	}
+
+	segments := strings.FieldsFunc(strings.ToUpper(name), func(r rune) bool { return r == '_' || r == '-' || r == '.' })
+	for _, segment := range segments {
+		if containsString(secretLookingNameParts, segment) {
+			return redactedValue
+		}
+	}
+
+	return value
+}
+
+// UnresolvedPlaceholder is a placeholder without value found in a manifest in strict mode
+type UnresolvedPlaceholder struct {
+	File string
+	Line int
+	Name string
+}
+
+// UnresolvedPlaceholdersError reports all placeholders without value in one or more manifests
+type UnresolvedPlaceholdersError struct {
+	Placeholders []UnresolvedPlaceholder
+}
+
+func (e *UnresolvedPlaceholdersError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%v unresolved placeholder(s); add them to placeholders or placeholderAllowlist:", len(e.Placeholders)))
+	for _, p := range e.Placeholders {
+		sb.WriteString(fmt.Sprintf("\n  %v:%v: $%v", p.File, p.Line, p.Name))
+	}
+	return sb.String()
+}
+
+// templateData is available as . in manifests rendered with the gotemplate renderer
+type templateData struct {
+	Params       Params
+	Placeholders map[string]string
+	Env          map[string]string
+}
+
+// goTemplateRenderer renders manifests as go text/template with a sprig-like set of functions; in strict mode keys missing from .Placeholders and .Env that aren't allowlisted are returned as error
+type goTemplateRenderer struct {
+	data      templateData
+	strict    bool
+	allowlist []string
+}
+
+// missingKeyErrorRegex matches the error text/template returns for a key missing from .Placeholders or .Env with option missingkey=error
+var missingKeyErrorRegex = regexp.MustCompile(`^template: .*:(\d+):\d+: executing ".*" at <\$?\.(Placeholders|Env)\.[^>]*>: map has no entry for key "(.*)"$`)
+
+func (r *goTemplateRenderer) Render(name string, content []byte) (string, error) {
+
+	// a missing key renders as empty value instead of <no value>, so default and required work for placeholders that aren't set
+	missingKey := "missingkey=zero"
+	if r.strict {
+		missingKey = "missingkey=error"
+	}
+
+	tmpl, err := template.New(name).Funcs(templateFuncs()).Option(missingKey).Parse(string(content))
+	if err != nil {
+		return "", fmt.Errorf("Failed parsing template %v: %w", name, err)
+	}
+
+	// execution stops at the first missing key, so every missing key gets an empty value and the template is executed again, to report all of them at once
+	data := r.data
+	data.Placeholders = copyStringMap(r.data.Placeholders)
+	data.Env = copyStringMap(r.data.Env)
+	unresolved := []UnresolvedPlaceholder{}
+
+	for {
+		var buf bytes.Buffer
+		err = tmpl.Execute(&buf, data)
+		if err == nil {
+			if len(unresolved) > 0 {
+				return "", &UnresolvedPlaceholdersError{Placeholders: unresolved}
+			}
+			return buf.String(), nil
+		}
+
+		match := missingKeyErrorRegex.FindStringSubmatch(err.Error())
+		if match == nil {
+			return "", fmt.Errorf("Failed executing template %v: %w", name, err)
+		}
+
+		if !matchesAny(r.allowlist, match[3]) {
+			line, _ := strconv.Atoi(match[1])
+			unresolved = append(unresolved, UnresolvedPlaceholder{File: name, Line: line, Name: match[3]})
+		}
+		if match[2] == "Env" {
+			data.Env[match[3]] = ""
+		} else {
+			data.Placeholders[match[3]] = ""
+		}
+	}
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	copied := map[string]string{}
+	for k, v := range m {
+		copied[k] = v
+	}
+	return copied
+}
+
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"default":  templateDefault,
+		"quote":    templateQuote,
+		"b64enc":   templateB64enc,
+		"toYaml":   templateToYaml,
+		"indent":   templateIndent,
+		"nindent":  templateNindent,
+		"required": templateRequired,
+	}
+}
+
+// templateDefault returns the default value if the given value is empty, so it can be used as {{ .Placeholders.NAME | default "value" }}
+func templateDefault(defaultValue interface{}, given ...interface{}) interface{} {
+	if len(given) == 0 || isEmpty(given[0]) {
+		return defaultValue
+	}
+	return given[0]
+}
+
+func templateQuote(values ...interface{}) string {
+	quoted := []string{}
+	for _, v := range values {
+		if v != nil {
+			quoted = append(quoted, fmt.Sprintf("%q", fmt.Sprint(v)))
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+func templateB64enc(value string) string {
+	return base64.StdEncoding.EncodeToString([]byte(value))
+}
+
+func templateToYaml(value interface{}) (string, error) {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
+
+func templateIndent(spaces int, value string) string {
+	padding := strings.Repeat(" ", spaces)
+	return padding + strings.ReplaceAll(value, "\n", "\n"+padding)
+}
+
+func templateNindent(spaces int, value string) string {
+	return "\n" + templateIndent(spaces, value)
+}
+
+func templateRequired(message string, value interface{}) (interface{}, error) {
+	if isEmpty(value) {
+		return nil, errors.New(message)
+	}
+	return value, nil
+}
+
+func isEmpty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
+
+// estafetteEnvironment returns the ESTAFETTE_ prefixed environment variables as a map
+func estafetteEnvironment(environ []string) map[string]string {
+	environment := map[string]string{}
+	for _, e := range environ {
+		keyValue := strings.SplitN(e, "=", 2)
+		if len(keyValue) == 2 && strings.HasPrefix(keyValue[0], "ESTAFETTE_") {
+			environment[keyValue[0]] = keyValue[1]
+		}
+	}
+	return environment
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRenderer(t *testing.T) {
+
+	t.Run("ReturnsPlaceholderRendererIfRendererIsEmpty", func(t *testing.T) {
+
+		// act
+		renderer, err := NewRenderer(Params{}, nil)
+
+		assert.Nil(t, err)
+		assert.IsType(t, &placeholderRenderer{}, renderer)
+	})
+
+	t.Run("ReturnsErrorIfRendererIsUnknown", func(t *testing.T) {
+
+		// act
+		_, err := NewRenderer(Params{Renderer: "jsonnet"}, nil)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestPlaceholderRendererRender(t *testing.T) {
+
+	t.Run("ReplacesKnownPlaceholdersAndKeepsUnknownPlaceholders", func(t *testing.T) {
+
+		renderer, _ := NewRenderer(Params{Placeholders: map[string]string{"APP_NAME": "myapp"}}, nil)
+
+		// act
+		rendered, err := renderer.Render("kubernetes.yaml", []byte("name: ${APP_NAME}\nversion: $VERSION\n"))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "name: myapp\nversion: $VERSION\n", rendered)
+	})
+
+	t.Run("ReplacesEnvironmentPlaceholdersMatchingPatternsUnlessSetExplicitly", func(t *testing.T) {
+
+		environ := []string{"ESTAFETTE_BUILD_VERSION=1.0.3", "ESTAFETTE_LABEL_APP=myapp", "HOME=/root", "GIT_SHA=abc123"}
+		params := Params{
+			Placeholders:            map[string]string{"ESTAFETTE_LABEL_APP": "otherapp"},
+			EnvironmentPlaceholders: []string{"ESTAFETTE_*", "GIT_SHA"},
+		}
+		renderer, _ := NewRenderer(params, environ)
+
+		// act
+		rendered, err := renderer.Render("kubernetes.yaml", []byte("name: ${ESTAFETTE_LABEL_APP}\nversion: $ESTAFETTE_BUILD_VERSION\nsha: $GIT_SHA\nhome: $HOME\n"))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "name: otherapp\nversion: 1.0.3\nsha: abc123\nhome: $HOME\n", rendered)
+	})
+}
+
+func TestMaskSecretLooking(t *testing.T) {
+
+	t.Run("MasksValuesOfSecretLookingNames", func(t *testing.T) {
+
+		assert.Equal(t, "***", maskSecretLooking("ESTAFETTE_GIT_TOKEN", "ghp_123", nil))
+		assert.Equal(t, "***", maskSecretLooking("db_password", "hunter2", nil))
+		assert.Equal(t, "***", maskSecretLooking("api-key", "abc123", nil))
+		assert.Equal(t, "1.0.3", maskSecretLooking("ESTAFETTE_BUILD_VERSION", "1.0.3", nil))
+	})
+
+	t.Run("DoesNotMaskNamesThatOnlyContainSecretLookingParts", func(t *testing.T) {
+
+		assert.Equal(t, "jane", maskSecretLooking("ESTAFETTE_GIT_AUTHOR", "jane", nil))
+		assert.Equal(t, "https://keycloak", maskSecretLooking("KEYCLOAK_URL", "https://keycloak", nil))
+	})
+
+	t.Run("MasksValuesOfNamesMatchingSensitivePatterns", func(t *testing.T) {
+
+		assert.Equal(t, "***", maskSecretLooking("DB_URL", "postgres://user:s3cr3t@db", []string{"DB_*"}))
+	})
+}
+
+func TestPlaceholderRendererRenderStrict(t *testing.T) {
+
+	t.Run("ReturnsErrorWithLineAndNameOfEveryUnresolvedPlaceholder", func(t *testing.T) {
+
+		renderer, _ := NewRenderer(Params{StrictPlaceholders: true, Placeholders: map[string]string{"APP_NAME": "myapp"}}, nil)
+
+		// act
+		_, err := renderer.Render("kubernetes.yaml", []byte("name: ${APP_NAME}\nversion: $VERSION\nteam: ${TEAM} $VERSION\n"))
+
+		assert.NotNil(t, err)
+		unresolvedErr, ok := err.(*UnresolvedPlaceholdersError)
+		assert.True(t, ok)
+		assert.Equal(t, []UnresolvedPlaceholder{
+			{File: "kubernetes.yaml", Line: 2, Name: "VERSION"},
+			{File: "kubernetes.yaml", Line: 3, Name: "TEAM"},
+			{File: "kubernetes.yaml", Line: 3, Name: "VERSION"},
+		}, unresolvedErr.Placeholders)
+		assert.Contains(t, err.Error(), "kubernetes.yaml:3: $TEAM")
+	})
+
+	t.Run("IgnoresAllowlistedPlaceholders", func(t *testing.T) {
+
+		renderer, _ := NewRenderer(Params{StrictPlaceholders: true, PlaceholderAllowlist: []string{"HOME", "SCRIPT_*"}}, nil)
+
+		// act
+		rendered, err := renderer.Render("kubernetes.yaml", []byte("script: echo $HOME ${SCRIPT_DIR}\n"))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "script: echo $HOME $SCRIPT_DIR\n", rendered)
+	})
+}
+
+func TestGoTemplateRendererRender(t *testing.T) {
+
+	params := Params{
+		Renderer:    "gotemplate",
+		Namespace:   "mynamespace",
+		Deployments: []string{"mydeployment"},
+		Placeholders: map[string]string{
+			"APP_NAME": "myapp",
+			"REPLICAS": "3",
+		},
+	}
+	environ := []string{"ESTAFETTE_BUILD_VERSION=1.0.3", "HOME=/root"}
+
+	t.Run("RendersParamsPlaceholdersAndEstafetteEnvironment", func(t *testing.T) {
+
+		renderer, _ := NewRenderer(params, environ)
+
+		// act
+		rendered, err := renderer.Render("kubernetes.yaml", []byte("name: {{ .Placeholders.APP_NAME }}\nnamespace: {{ .Params.Namespace }}\nversion: {{ .Env.ESTAFETTE_BUILD_VERSION | quote }}\nhome: {{ .Env.HOME | default \"none\" }}\n"))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "name: myapp\nnamespace: mynamespace\nversion: \"1.0.3\"\nhome: none\n", rendered)
+	})
+
+	t.Run("SupportsConditionalsAndLoops", func(t *testing.T) {
+
+		renderer, _ := NewRenderer(params, environ)
+
+		// act
+		rendered, err := renderer.Render("kubernetes.yaml", []byte("{{ range .Params.Deployments }}- {{ . }}\n{{ end }}{{ if eq .Placeholders.REPLICAS \"3\" }}ha: true{{ end }}\n"))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "- mydeployment\nha: true\n", rendered)
+	})
+
+	t.Run("SupportsToYamlIndentAndB64enc", func(t *testing.T) {
+
+		renderer, _ := NewRenderer(params, environ)
+
+		// act
+		rendered, err := renderer.Render("kubernetes.yaml", []byte("data:\n{{ toYaml .Params.Deployments | indent 2 }}\nsecret: {{ b64enc .Placeholders.APP_NAME }}\n"))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "data:\n  - mydeployment\nsecret: bXlhcHA=\n", rendered)
+	})
+
+	t.Run("RendersMissingKeyAsEmptyValue", func(t *testing.T) {
+
+		renderer, _ := NewRenderer(params, environ)
+
+		// act
+		rendered, err := renderer.Render("kubernetes.yaml", []byte("version: {{ .Placeholders.VERSION }}\ntier: {{ .Placeholders.TIER | default \"backend\" }}\n"))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "version: \ntier: backend\n", rendered)
+	})
+
+	t.Run("ReturnsErrorIfRequiredValueIsEmpty", func(t *testing.T) {
+
+		renderer, _ := NewRenderer(params, environ)
+
+		// act
+		_, err := renderer.Render("kubernetes.yaml", []byte("version: {{ required \"VERSION is required\" .Placeholders.VERSION }}\n"))
+
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "VERSION is required")
+	})
+
+	t.Run("ReturnsErrorWithLineAndNameOfEveryMissingKeyIfStrict", func(t *testing.T) {
+
+		strictParams := params
+		strictParams.StrictPlaceholders = true
+		strictParams.PlaceholderAllowlist = []string{"OPTIONAL_*"}
+		renderer, _ := NewRenderer(strictParams, environ)
+
+		// act
+		_, err := renderer.Render("kubernetes.yaml", []byte("name: {{ .Placeholders.APP_NAME }}\nversion: {{ .Placeholders.TYPO }}\nbuild: {{ .Env.ESTAFETTE_BUILD_TYPO }}\nextra: {{ .Placeholders.OPTIONAL_EXTRA }}\n"))
+
+		assert.NotNil(t, err)
+		unresolvedErr, ok := err.(*UnresolvedPlaceholdersError)
+		assert.True(t, ok)
+		assert.Equal(t, []UnresolvedPlaceholder{
+			{File: "kubernetes.yaml", Line: 2, Name: "TYPO"},
+			{File: "kubernetes.yaml", Line: 3, Name: "ESTAFETTE_BUILD_TYPO"},
+		}, unresolvedErr.Placeholders)
+	})
+
+	t.Run("ReturnsErrorIfTemplateIsInvalid", func(t *testing.T) {
+
+		renderer, _ := NewRenderer(params, environ)
+
+		// act
+		_, err := renderer.Render("kubernetes.yaml", []byte("name: {{ .Placeholders.APP_NAME "))
+
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// workload identifies a deployment, statefulset or daemonset to await the rollout of
+type workload struct {
+	kind string
+	name string
+}
+
+func (w workload) String() string {
+	return fmt.Sprintf("%v/%v", w.kind, w.name)
+}
+
+type rolloutResult struct {
+	workload workload
+	err      error
+}
+
+// workloads returns the deployments, statefulsets and daemonsets to await the rollouts of
+func (d *Deployer) workloads() []workload {
+	workloads := []workload{}
+	for _, name := range d.params.Deployments {
+		workloads = append(workloads, workload{kind: "deployment", name: name})
+	}
+	for _, name := range d.params.Statefulsets {
+		workloads = append(workloads, workload{kind: "statefulset", name: name})
+	}
+	for _, name := range d.params.Daemonsets {
+		workloads = append(workloads, workload{kind: "daemonset", name: name})
+	}
+	return workloads
+}
+
+// recordRevisions stores the revision of every workload before the apply, so only workloads the apply created a new revision for are rolled back
+func (d *Deployer) recordRevisions(ctx context.Context) {
+	d.revisions = map[string]int64{}
+	for _, w := range d.workloads() {
+		revision, err := d.engine.RolloutRevision(ctx, w.kind, w.name)
+		if err != nil {
+			log.Warn().Msgf("Failed getting the revision of %v before applying: %v", w, err)
+			continue
+		}
+		d.revisions[w.String()] = revision
+	}
+}
+
+// awaitRollouts waits for the rollouts of all deployments, statefulsets and daemonsets and rolls back the ones that failed if autoRollback is set; the release fails either way
+func (d *Deployer) awaitRollouts(ctx context.Context) error {
+
+	workloads := d.workloads()
+	if len(workloads) == 0 {
+		return nil
+	}
+
+	failed, err := d.awaitWorkloads(ctx, workloads)
+	if err != nil && d.params.AutoRollback {
+		d.rollback(ctx, failed)
+	}
+
+	return err
+}
+
+// rolloutCanceledError is returned for a rollout that's no longer awaited because another workload failed; the workload itself didn't fail, so it isn't rolled back
+type rolloutCanceledError struct {
+	workload workload
+}
+
+func (e *rolloutCanceledError) Error() string {
+	return fmt.Sprintf("Rollout of %v was canceled because another workload failed", e.workload)
+}
+
+// awaitWorkloads waits for the rollouts of all workloads at once, within the rollout deadline and per workload deadline; the first failing rollout cancels the others and is returned together with all workloads that failed or passed their deadline
+func (d *Deployer) awaitWorkloads(ctx context.Context, workloads []workload) (failed []workload, err error) {
+
+	rolloutCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if d.params.RolloutTimeoutSeconds > 0 {
+		rolloutCtx, cancel = context.WithTimeout(rolloutCtx, time.Duration(d.params.RolloutTimeoutSeconds)*time.Second)
+		defer cancel()
+	}
+
+	log.Info().Msgf("Waiting for %v workload(s) to finish rolling out...", len(workloads))
+
+	results := make(chan rolloutResult, len(workloads))
+	pending := map[string]bool{}
+	for _, w := range workloads {
+		pending[w.String()] = true
+		go func(w workload) {
+			results <- rolloutResult{workload: w, err: d.awaitRollout(ctx, rolloutCtx, w)}
+		}(w)
+	}
+
+	for i := 1; i <= len(workloads); i++ {
+		result := <-results
+		delete(pending, result.workload.String())
+
+		var canceledErr *rolloutCanceledError
+		if errors.As(result.err, &canceledErr) {
+			log.Warn().Msgf("%v", result.err)
+			continue
+		}
+		if result.err != nil {
+			if err == nil {
+				err = result.err
+				// stop waiting for the other workloads
+				cancel()
+			}
+			log.Error().Msgf("%v failed rolling out: %v", result.workload, result.err)
+			failed = append(failed, result.workload)
+			continue
+		}
+
+		log.Info().Msgf("%v rolled out; %v/%v done, waiting for %v", result.workload, i, len(workloads), pendingWorkloads(pending))
+	}
+
+	return failed, err
+}
+
+// rollback undoes the rollout of the workloads the apply created a new revision for, waits for them to roll out again and logs a summary
+func (d *Deployer) rollback(ctx context.Context, workloads []workload) {
+
+	log.Info().Msg("\nROLLBACK\n")
+
+	summary := []string{}
+	rolledBack := []workload{}
+	for _, w := range workloads {
+		if before, ok := d.revisions[w.String()]; ok {
+			current, err := d.engine.RolloutRevision(ctx, w.kind, w.name)
+			if err == nil && current == before {
+				summary = append(summary, fmt.Sprintf("%v has no new revision, so it isn't rolled back", w))
+				continue
+			}
+		}
+
+		log.Info().Msgf("Rolling back %v...", w)
+		revision, err := d.engine.RolloutUndo(ctx, w.kind, w.name)
+		if err != nil {
+			summary = append(summary, fmt.Sprintf("%v could not be rolled back: %v", w, err))
+			continue
+		}
+		summary = append(summary, fmt.Sprintf("%v rolled back to revision %v", w, revision))
+		rolledBack = append(rolledBack, w)
+	}
+
+	if len(rolledBack) > 0 {
+		_, err := d.awaitWorkloads(ctx, rolledBack)
+		if err != nil {
+			summary = append(summary, fmt.Sprintf("rolled back workloads failed rolling out: %v", err))
+		}
+	}
+
+	log.Info().Msgf("Rollback summary:\n  %v", strings.Join(summary, "\n  "))
+}
+
+// awaitRollout waits for a single rollout within the per workload deadline and labels the workload afterwards, even if the rollout failed
+func (d *Deployer) awaitRollout(ctx, rolloutCtx context.Context, w workload) error {
+
+	workloadCtx := rolloutCtx
+	if d.params.WorkloadTimeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		workloadCtx, cancel = context.WithTimeout(rolloutCtx, time.Duration(d.params.WorkloadTimeoutSeconds)*time.Second)
+		defer cancel()
+	}
+
+	err := d.engine.RolloutStatus(workloadCtx, w.kind, w.name)
+	if errors.Is(workloadCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("Rollout of %v did not finish before the deadline", w)
+	} else if errors.Is(workloadCtx.Err(), context.Canceled) && ctx.Err() == nil {
+		err = &rolloutCanceledError{workload: w}
+	}
+
+	labelErr := d.engine.LabelWorkload(ctx, w.kind, w.name, d.labels())
+	if labelErr != nil {
+		log.Error().Msgf("Error with labeling %v with error: %v", w, labelErr)
+	}
+
+	return err
+}
+
+func pendingWorkloads(pending map[string]bool) string {
+	if len(pending) == 0 {
+		return "none"
+	}
+	names := []string{}
+	for name := range pending {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
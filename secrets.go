@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// secretManagerScheme prefixes placeholder values that reference a secret manager secret version, like gsm://projects/my-project/secrets/my-secret/versions/latest
+const secretManagerScheme = "gsm://"
+
+var secretVersionNameRegex = regexp.MustCompile(`^projects/[^/]+/secrets/[^/]+/versions/[^/]+$`)
+
+// SecretResolver returns the value of a secret reference, so tests can replace secret manager
+type SecretResolver interface {
+	Resolve(ctx context.Context, reference string) (string, error)
+}
+
+// NewSecretManagerResolver returns a SecretResolver that accesses secret versions with the secret manager api, with an access token for the credential
+func NewSecretManagerResolver(credential GKECredentials, accessToken func(ctx context.Context, credential GKECredentials) (string, error)) SecretResolver {
+	return &secretManagerResolver{
+		credential:  credential,
+		accessToken: accessToken,
+		client:      http.DefaultClient,
+		endpoint:    "https://secretmanager.googleapis.com",
+	}
+}
+
+type secretManagerResolver struct {
+	credential  GKECredentials
+	accessToken func(ctx context.Context, credential GKECredentials) (string, error)
+	client      *http.Client
+	endpoint    string
+}
+
+func (r *secretManagerResolver) Resolve(ctx context.Context, reference string) (string, error) {
+
+	name := strings.TrimPrefix(reference, secretManagerScheme)
+	if !secretVersionNameRegex.MatchString(name) {
+		return "", fmt.Errorf("Secret reference %v is not of the form %vprojects/<project>/secrets/<secret>/versions/<version>", reference, secretManagerScheme)
+	}
+
+	token, err := r.accessToken(ctx, r.credential)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%v/v1/%v:access", r.endpoint, name), nil)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	response, err := r.client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("Failed accessing secret %v: %w", reference, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Failed accessing secret %v: status %v", reference, response.Status)
+	}
+
+	var result struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		return "", fmt.Errorf("Failed decoding secret %v: %w", reference, err)
+	}
+
+	value, err := base64.StdEncoding.DecodeString(result.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("Failed decoding payload of secret %v: %w", reference, err)
+	}
+
+	return string(value), nil
+}
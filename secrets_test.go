@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSecretResolver resolves references from memory
+type fakeSecretResolver map[string]string
+
+func (r fakeSecretResolver) Resolve(ctx context.Context, reference string) (string, error) {
+	value, ok := r[reference]
+	if !ok {
+		return "", fmt.Errorf("Secret %v does not exist", reference)
+	}
+	return value, nil
+}
+
+func TestSecretManagerResolverResolve(t *testing.T) {
+
+	newTestResolver := func(handler http.HandlerFunc) (*secretManagerResolver, *httptest.Server) {
+		server := httptest.NewServer(handler)
+		resolver := NewSecretManagerResolver(validCredential, func(ctx context.Context, credential GKECredentials) (string, error) { return "access-token", nil }).(*secretManagerResolver)
+		resolver.endpoint = server.URL
+		return resolver, server
+	}
+
+	t.Run("ReturnsDecodedPayloadOfSecretVersion", func(t *testing.T) {
+
+		resolver, server := newTestResolver(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/v1/projects/my-project/secrets/db-password/versions/latest:access", r.URL.Path)
+			assert.Equal(t, "Bearer access-token", r.Header.Get("Authorization"))
+			fmt.Fprint(w, `{"name":"projects/123/secrets/db-password/versions/3","payload":{"data":"czNjcjN0"}}`)
+		})
+		defer server.Close()
+
+		// act
+		value, err := resolver.Resolve(context.Background(), "gsm://projects/my-project/secrets/db-password/versions/latest")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "s3cr3t", value)
+	})
+
+	t.Run("ReturnsErrorIfSecretCanNotBeAccessed", func(t *testing.T) {
+
+		resolver, server := newTestResolver(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		})
+		defer server.Close()
+
+		// act
+		_, err := resolver.Resolve(context.Background(), "gsm://projects/my-project/secrets/db-password/versions/latest")
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsErrorIfReferenceIsNotASecretVersion", func(t *testing.T) {
+
+		resolver, server := newTestResolver(func(w http.ResponseWriter, r *http.Request) {
+			t.Fail()
+		})
+		defer server.Close()
+
+		// act
+		_, err := resolver.Resolve(context.Background(), "gsm://projects/my-project/secrets/db-password")
+
+		assert.NotNil(t, err)
+	})
+}
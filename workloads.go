@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+)
+
+// awaitAnnotation opts a discovered workload out of being awaited when set to false
+const awaitAnnotation = "estafette.io/await"
+
+// Workloads are the names of the workloads to await per kind
+type Workloads struct {
+	Deployments  []string
+	Statefulsets []string
+	Daemonsets   []string
+	Jobs         []string
+}
+
+// DiscoverWorkloads returns the deployments, statefulsets, daemonsets and jobs defined in the manifests, skipping the ones annotated with estafette.io/await: "false" and the ones in another namespace than the release namespace
+func DiscoverWorkloads(manifestPaths []string, namespace string) (Workloads, error) {
+
+	workloads := Workloads{}
+	seen := map[string]bool{}
+
+	for _, m := range manifestPaths {
+		objects, err := readObjects(m)
+		if err != nil {
+			return workloads, err
+		}
+
+		for _, obj := range objects {
+			if obj.GetNamespace() != "" && namespace != "" && obj.GetNamespace() != namespace {
+				continue
+			}
+			if strings.EqualFold(obj.GetAnnotations()[awaitAnnotation], "false") {
+				continue
+			}
+
+			key := obj.GetKind() + "/" + obj.GetName()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			switch obj.GetKind() {
+			case "Deployment":
+				workloads.Deployments = append(workloads.Deployments, obj.GetName())
+			case "StatefulSet":
+				workloads.Statefulsets = append(workloads.Statefulsets, obj.GetName())
+			case "DaemonSet":
+				workloads.Daemonsets = append(workloads.Daemonsets, obj.GetName())
+			case "Job":
+				workloads.Jobs = append(workloads.Jobs, obj.GetName())
+			}
+		}
+	}
+
+	return workloads, nil
+}
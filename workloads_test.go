@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscoverWorkloads(t *testing.T) {
+
+	t.Run("ReturnsWorkloadsOfAllKindsInAllManifests", func(t *testing.T) {
+
+		dir := t.TempDir()
+		manifest1 := filepath.Join(dir, "kubernetes.yaml")
+		manifest2 := filepath.Join(dir, "jobs.yaml")
+		assert.Nil(t, ioutil.WriteFile(manifest1, []byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: mydeployment\n---\napiVersion: v1\nkind: Service\nmetadata:\n  name: myservice\n---\napiVersion: apps/v1\nkind: StatefulSet\nmetadata:\n  name: mystatefulset\n  namespace: mynamespace\n---\napiVersion: apps/v1\nkind: DaemonSet\nmetadata:\n  name: mydaemonset\n"), 0666))
+		assert.Nil(t, ioutil.WriteFile(manifest2, []byte("apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: myjob\n---\napiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: mydeployment\n"), 0666))
+
+		// act
+		workloads, err := DiscoverWorkloads([]string{manifest1, manifest2}, "mynamespace")
+
+		assert.Nil(t, err)
+		assert.Equal(t, Workloads{
+			Deployments:  []string{"mydeployment"},
+			Statefulsets: []string{"mystatefulset"},
+			Daemonsets:   []string{"mydaemonset"},
+			Jobs:         []string{"myjob"},
+		}, workloads)
+	})
+
+	t.Run("SkipsWorkloadsWithAwaitAnnotationFalseOrInOtherNamespace", func(t *testing.T) {
+
+		manifest := filepath.Join(t.TempDir(), "kubernetes.yaml")
+		assert.Nil(t, ioutil.WriteFile(manifest, []byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: mydeployment\n  annotations:\n    estafette.io/await: \"false\"\n---\napiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: otherdeployment\n  namespace: othernamespace\n"), 0666))
+
+		// act
+		workloads, err := DiscoverWorkloads([]string{manifest}, "mynamespace")
+
+		assert.Nil(t, err)
+		assert.Equal(t, Workloads{}, workloads)
+	})
+}